@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+)
+
+// NewTokenSource returns a TokenSource using the credentials in ConfigData,
+// resolving them first. Unless disabled with --no-token-cache, tokens are
+// reused from the cache until shortly before they expire.
+func NewTokenSource(s sunat.Sunat) sunat.TokenSource {
+	if err := ResolveAuthSecrets(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	params := sunat.AuthParams{
+		ClientID:     ConfigData.ClientID,
+		ClientSecret: ConfigData.ClientSecret,
+		Password:     ConfigData.Password,
+		Username:     ConfigData.User,
+		Scope:        ConfigData.Scope,
+		GrantType:    sunat.GrantType(ConfigData.GrantType),
+	}
+
+	if ConfigData.NoTokenCache {
+		return sunat.NewPasswordTokenSource(s, ConfigData.AuthBaseURL, params)
+	}
+
+	cacheDir, err := sunat.DefaultTokenCacheDir()
+	if err != nil {
+		s.Logger.Warnf("Token cache disabled: %v", err)
+		return sunat.NewPasswordTokenSource(s, ConfigData.AuthBaseURL, params)
+	}
+
+	return sunat.NewCachedTokenSource(s, ConfigData.AuthBaseURL, params, sunat.NewTokenCache(cacheDir))
+}
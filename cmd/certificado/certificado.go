@@ -0,0 +1,35 @@
+package certificado
+
+import (
+	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/spf13/cobra"
+)
+
+var CertificadoCmd = &cobra.Command{
+	Use:   "certificado",
+	Short: "Administrar el certificado digital usado para firmar los comprobantes",
+	Long: `Administrar el certificado digital usado para firmar los comprobantes.
+
+Los comandos usan el certificado indicado como argumento o, si no se indica, el
+configurado con --cert. La clave privada y la contraseña se toman de --cert-key
+y --cert-password (o --cert-password-file).`,
+}
+
+// CertificatePath returns the certificate given as argument or the one
+// configured with --cert
+func CertificatePath(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	// The certificate may be configured in the credentials vault
+	if err := cmd.ResolveCertSecrets(); err != nil {
+		return "", err
+	}
+
+	return cmd.ConfigData.Cert, nil
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(CertificadoCmd)
+}
@@ -0,0 +1,73 @@
+package convertir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/certificado"
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+	"github.com/spf13/cobra"
+)
+
+var outputPassword string
+
+var ConvertirCmd = &cobra.Command{
+	Use:   "convertir <entrada> <salida>",
+	Short: "Convierte el certificado digital entre PKCS#12 (.p12, .pfx) y PEM",
+	Long: `Convierte el certificado digital entre PKCS#12 (.p12, .pfx) y PEM. El formato
+de salida se obtiene de la extensión del archivo de salida.
+
+El archivo PEM contiene el certificado, la cadena y la clave privada sin cifrar, se
+crea con permisos solo para el usuario actual. El archivo PKCS#12 se protege con
+--output-password o, si no se indica, con la contraseña del certificado de entrada.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(c *cobra.Command, args []string) {
+		input, output := args[0], args[1]
+
+		cert, err := cmd.LoadCertificateFile(input)
+		if err != nil {
+			cmd.PrintError(err)
+			os.Exit(1)
+		}
+
+		var data []byte
+		switch strings.ToLower(filepath.Ext(output)) {
+		case ".p12", ".pfx":
+			password := outputPassword
+			if password == "" {
+				password = cmd.ConfigData.CertPassword
+			}
+
+			if password == "" {
+				fmt.Fprintln(os.Stderr, "advertencia: el archivo PKCS#12 no estará protegido con contraseña")
+			}
+
+			data, err = firma.EncodePKCS12(cert, password)
+		case ".pem", ".crt", ".cer":
+			data, err = firma.EncodePEM(cert)
+		default:
+			fmt.Fprintf(os.Stderr, "error: extensión de salida no soportada '%s', use .p12, .pfx o .pem\n", filepath.Ext(output))
+			os.Exit(1)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := os.WriteFile(output, data, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Certificado guardado en %s\n", output)
+	},
+}
+
+func init() {
+	certificado.CertificadoCmd.AddCommand(ConvertirCmd)
+	ConvertirCmd.Flags().StringVar(&outputPassword, "output-password", "", "Contraseña del archivo PKCS#12 de salida")
+}
@@ -0,0 +1,126 @@
+package info
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/certificado"
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+	"github.com/spf13/cobra"
+)
+
+var outputFormat string
+
+var InfoCmd = &cobra.Command{
+	Use:   "info [certificado]",
+	Short: "Muestra la información del certificado digital",
+	Long: `Muestra el titular, RUC, emisor, número de serie y vigencia del certificado
+digital (PKCS#12 o PEM).`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		if outputFormat != "text" && outputFormat != "json" {
+			fmt.Fprintf(os.Stderr, "error: formato de salida no soportado '%s', use 'text' o 'json'\n", outputFormat)
+			os.Exit(1)
+		}
+
+		path, err := certificado.CertificatePath(args)
+		if err != nil {
+			cmd.PrintError(err)
+			os.Exit(1)
+		}
+
+		if path == "" {
+			cmd.PrintError(cmd.ErrNoCertificate)
+			os.Exit(1)
+		}
+
+		cert, err := cmd.LoadCertificateFile(path)
+		if err != nil {
+			cmd.PrintError(err)
+			os.Exit(1)
+		}
+
+		info := newCertificateInfo(cert)
+
+		if outputFormat == "json" {
+			out, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Println(string(out))
+			return
+		}
+
+		printCertificateInfo(info)
+		cmd.WarnCertificateExpiry(cert)
+	},
+}
+
+type certificateInfo struct {
+	Subject   string    `json:"subject"`
+	RUCs      []string  `json:"rucs,omitempty"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	ExpiresIn int64     `json:"expires_in"`
+	Expired   bool      `json:"expired"`
+	KeyBits   int       `json:"key_bits"`
+	Chain     []string  `json:"chain,omitempty"`
+}
+
+func newCertificateInfo(cert *firma.Certificate) certificateInfo {
+	info := certificateInfo{
+		Subject:   cert.Leaf.Subject.String(),
+		RUCs:      cert.RUCs(),
+		Issuer:    cert.Leaf.Issuer.String(),
+		Serial:    fmt.Sprintf("%X", cert.Leaf.SerialNumber),
+		NotBefore: cert.Leaf.NotBefore,
+		NotAfter:  cert.Leaf.NotAfter,
+		ExpiresIn: int64(time.Until(cert.Leaf.NotAfter).Seconds()),
+		KeyBits:   cert.PrivateKey.N.BitLen(),
+	}
+
+	info.Expired = info.ExpiresIn <= 0
+
+	for _, c := range cert.Chain {
+		info.Chain = append(info.Chain, c.Subject.String())
+	}
+
+	return info
+}
+
+func printCertificateInfo(info certificateInfo) {
+	fmt.Printf("Titular:      %s\n", info.Subject)
+	if len(info.RUCs) > 0 {
+		fmt.Printf("RUC:          %s\n", strings.Join(info.RUCs, ", "))
+	} else {
+		fmt.Println("RUC:          no encontrado en el titular")
+	}
+	fmt.Printf("Emisor:       %s\n", info.Issuer)
+	fmt.Printf("Serie:        %s\n", info.Serial)
+	fmt.Printf("Clave:        RSA %d bits\n", info.KeyBits)
+	fmt.Printf("Válido desde: %s\n", info.NotBefore.Local().Format(time.RFC3339))
+	fmt.Printf("Válido hasta: %s\n", info.NotAfter.Local().Format(time.RFC3339))
+
+	if info.Expired {
+		fmt.Println("Vigencia:     vencido")
+	} else {
+		fmt.Printf("Vigencia:     %d días\n", info.ExpiresIn/(24*60*60))
+	}
+
+	for _, c := range info.Chain {
+		fmt.Printf("Cadena:       %s\n", c)
+	}
+}
+
+func init() {
+	certificado.CertificadoCmd.AddCommand(InfoCmd)
+	InfoCmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Formato de salida: text o json")
+}
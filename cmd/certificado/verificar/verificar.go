@@ -0,0 +1,82 @@
+package verificar
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/certificado"
+	"github.com/spf13/cobra"
+)
+
+var ruc string
+
+var VerificarCmd = &cobra.Command{
+	Use:   "verificar [certificado]",
+	Short: "Verifica que el certificado digital se pueda usar para firmar",
+	Long: `Verifica que el certificado digital se pueda usar para firmar: que la clave
+privada corresponda al certificado, que esté vigente, que no venza dentro del
+plazo de --cert-expiry-warning y, con --ruc, que pertenezca a ese RUC.
+
+Termina con código 1 si alguna verificación falla, para usarlo en tareas programadas.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		path, err := certificado.CertificatePath(args)
+		if err != nil {
+			cmd.PrintError(err)
+			os.Exit(1)
+		}
+
+		if path == "" {
+			cmd.PrintError(cmd.ErrNoCertificate)
+			os.Exit(1)
+		}
+
+		cert, err := cmd.LoadCertificateFile(path)
+		if err != nil {
+			cmd.PrintError(err)
+			os.Exit(1)
+		}
+
+		fmt.Println("OK    la clave privada corresponde al certificado")
+
+		failed := false
+		now := time.Now()
+
+		if err := cert.CheckValidity(now); err != nil {
+			fmt.Printf("ERROR %v\n", err)
+			failed = true
+		} else if cert.ExpiresWithin(now, cmd.ConfigData.CertExpiryWarning) {
+			fmt.Printf("AVISO el certificado vence el %s, dentro del plazo de advertencia (%s)\n", cert.Leaf.NotAfter.Local().Format(time.DateOnly), cmd.ConfigData.CertExpiryWarning)
+			failed = true
+		} else {
+			fmt.Printf("OK    vigente hasta %s\n", cert.Leaf.NotAfter.Local().Format(time.DateOnly))
+		}
+
+		if ruc != "" {
+			found := false
+			for _, r := range cert.RUCs() {
+				if r == ruc {
+					found = true
+				}
+			}
+
+			if found {
+				fmt.Printf("OK    emitido al RUC %s\n", ruc)
+			} else {
+				fmt.Printf("ERROR no fue emitido al RUC %s (titular: %s)\n", ruc, cert.Leaf.Subject.String())
+				failed = true
+			}
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	certificado.CertificadoCmd.AddCommand(VerificarCmd)
+	VerificarCmd.Flags().StringVar(&ruc, "ruc", "", "RUC al que debe pertenecer el certificado")
+}
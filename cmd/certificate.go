@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+)
+
+var ErrNoCertificate = errors.New("no certificate configured, use --cert")
+
+// LoadCertificate loads the certificate configured with --cert
+func LoadCertificate() (*firma.Certificate, error) {
+	// The certificate may be configured in the credentials vault
+	if err := ResolveCertSecrets(); err != nil {
+		return nil, err
+	}
+
+	if ConfigData.Cert == "" {
+		return nil, ErrNoCertificate
+	}
+
+	return LoadCertificateFile(ConfigData.Cert)
+}
+
+// LoadCertificateFile loads the certificate in path with the private key
+// and password configured with --cert-key and --cert-password
+func LoadCertificateFile(path string) (*firma.Certificate, error) {
+	if err := ResolveCertSecrets(); err != nil {
+		return nil, err
+	}
+
+	return firma.LoadCertificate(path, firma.LoadOptions{
+		KeyPath:  ConfigData.CertKey,
+		Password: ConfigData.CertPassword,
+	})
+}
+
+// LoadSigningCertificate loads the certificate configured with --cert and
+// checks that it can be used to sign now, warning if it expires soon
+func LoadSigningCertificate() (*firma.Certificate, error) {
+	cert, err := LoadCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cert.CheckValidity(time.Now()); err != nil {
+		return nil, err
+	}
+
+	WarnCertificateExpiry(cert)
+
+	return cert, nil
+}
+
+// WarnCertificateExpiry prints a warning to stderr when cert expires within
+// the window configured with --cert-expiry-warning
+func WarnCertificateExpiry(cert *firma.Certificate) {
+	now := time.Now()
+	if now.After(cert.Leaf.NotAfter) || !cert.ExpiresWithin(now, ConfigData.CertExpiryWarning) {
+		return
+	}
+
+	days := int(cert.Leaf.NotAfter.Sub(now).Hours() / 24)
+	fmt.Fprintf(os.Stderr, "advertencia: el certificado digital vence el %s (en %d días), renuévelo antes de esa fecha\n", cert.Leaf.NotAfter.Local().Format(time.DateOnly), days)
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+)
+
+var limiter *sunat.RateLimiter
+var limiterOnce sync.Once
+
+var httpClient *http.Client
+var httpClientOnce sync.Once
+
+var harRecorder *sunat.HARRecorder
+var harRecorderOnce sync.Once
+
+var redactor *sunat.Redactor
+var redactorOnce sync.Once
+
+// NewSunat returns a Sunat client configured with ConfigData
+func NewSunat() sunat.Sunat {
+	s := sunat.Sunat{
+		Logger: GetLogger(),
+		Retry: sunat.RetryPolicy{
+			MaxAttempts: ConfigData.RetryMaxAttempts,
+			BaseDelay:   ConfigData.RetryBaseDelay,
+			MaxDelay:    ConfigData.RetryMaxDelay,
+			Jitter:      ConfigData.RetryJitter,
+		},
+		Limiter:        getLimiter(),
+		HTTPClient:     getHTTPClient(),
+		Timeout:        ConfigData.Timeout,
+		HAR:            getHARRecorder(),
+		Redactor:       getRedactor(),
+		MaxPayloadSize: ConfigData.MaxPayloadSize,
+	}
+	s.Tokens = NewTokenSource(s)
+	s.SendLog = NewSendLog(s)
+
+	return s
+}
+
+// NewSendLog returns the record of sent receipts in --send-log-dir, nil if
+// disabled with --no-send-log
+func NewSendLog(s sunat.Sunat) *sunat.SendLog {
+	if ConfigData.NoSendLog {
+		return nil
+	}
+
+	dir := ConfigData.SendLogDir
+	if dir == "" {
+		var err error
+		dir, err = sunat.DefaultSendLogDir()
+		if err != nil {
+			s.Logger.Warnf("Send log disabled: %v", err)
+			return nil
+		}
+	}
+
+	sendLog := sunat.NewSendLog(dir)
+
+	return &sendLog
+}
+
+// getLimiter returns the rate limiter shared by all the clients. Its limits
+// are kept in the user cache folder, so they also apply to the other
+// processes of the user running at the same time.
+func getLimiter() *sunat.RateLimiter {
+	limiterOnce.Do(func() {
+		limits := map[sunat.EndpointClass]sunat.RateLimit{
+			sunat.EndpointAuth:  {RequestsPerSecond: ConfigData.RateLimitAuth},
+			sunat.EndpointSend:  {RequestsPerSecond: ConfigData.RateLimitSend},
+			sunat.EndpointQuery: {RequestsPerSecond: ConfigData.RateLimitQuery},
+		}
+
+		dir, err := sunat.DefaultRateLimitDir()
+		if err != nil {
+			GetLogger().Warnf("Rate limits apply only to this process: %v", err)
+			limiter = sunat.NewRateLimiter(limits)
+			return
+		}
+
+		limiter = sunat.NewSharedRateLimiter(dir, limits)
+	})
+
+	return limiter
+}
+
+// getHTTPClient returns the HTTP client shared by all the clients, so
+// connections are reused
+func getHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		var err error
+		httpClient, err = sunat.NewHTTPClient(sunat.HTTPOptions{
+			ProxyURL:          ConfigData.Proxy,
+			CABundle:          ConfigData.CABundle,
+			ConnectTimeout:    ConfigData.ConnectTimeout,
+			ReadTimeout:       ConfigData.ReadTimeout,
+			KeepAlive:         ConfigData.KeepAlive,
+			IdleConnTimeout:   sunat.DefaultHTTPOptions.IdleConnTimeout,
+			DisableKeepAlives: ConfigData.DisableKeepAlives,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	})
+
+	return httpClient
+}
+
+// getHARRecorder returns the recorder shared by all the clients, nil if
+// --har is not set
+func getHARRecorder() *sunat.HARRecorder {
+	harRecorderOnce.Do(func() {
+		if ConfigData.HAR == "" {
+			return
+		}
+
+		harRecorder = sunat.NewHARRecorder(ConfigData.HAR, sunat.HAROptions{
+			CreatorName:      "sunatapi",
+			CreatorVersion:   strings.TrimSpace(ver),
+			TruncatePayloads: ConfigData.HARTruncate,
+		})
+	})
+
+	return harRecorder
+}
+
+// CloseHAR closes the HAR file of --har, if any. The file is complete
+// without it, it only releases the file.
+func CloseHAR() {
+	if harRecorder == nil {
+		return
+	}
+
+	if err := harRecorder.Close(); err != nil {
+		GetLogger().Warnf("Could not close HAR file: %v", err)
+	}
+}
+
+// getRedactor returns the redactor used to mask secrets in the logs
+func getRedactor() *sunat.Redactor {
+	redactorOnce.Do(func() {
+		redactor = sunat.NewRedactor(ConfigData.RedactFields...)
+		if ConfigData.UnsafeLogSecrets {
+			redactor.Disabled = true
+			GetLogger().Warn("--unsafe-log-secrets: las credenciales y tokens se mostrarán en los logs")
+		}
+	})
+
+	return redactor
+}
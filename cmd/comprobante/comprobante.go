@@ -1,7 +1,17 @@
 package comprobante
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
 	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+	"github.com/haguirrear/sunatapi/pkg/ubl"
 	"github.com/spf13/cobra"
 )
 
@@ -23,3 +33,87 @@ func init() {
 	// is called directly, e.g.:
 	// reciboCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// ReceiptName returns the name used to send the receipt in path. With
+// fromXML it is derived from the content of the XML, so misnamed files can
+// still be sent.
+func ReceiptName(path string, fromXML bool) (string, error) {
+	if !fromXML {
+		return path, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	id, err := sunat.DocumentIDFromXML(f)
+	if err != nil {
+		return "", fmt.Errorf("error deriving file name of %s: %w", path, err)
+	}
+
+	if id.RUC == "" {
+		return "", fmt.Errorf("error deriving file name of %s: the xml does not include the issuer RUC", path)
+	}
+
+	if err := id.Validate(); err != nil {
+		return "", fmt.Errorf("error deriving file name of %s: %w", path, err)
+	}
+
+	return filepath.Join(filepath.Dir(path), id.XMLFileName()), nil
+}
+
+// ValidateReceipt checks the structure of the guía de remisión in path
+// before it is sent
+func ValidateReceipt(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ubl.ValidateDespatchAdvice(f)
+}
+
+// PrintValidationErrors prints to stderr every problem found by
+// ValidateReceipt
+func PrintValidationErrors(path string, err error) {
+	var errs ubl.ValidationErrors
+	if !errors.As(err, &errs) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "El comprobante %s no es válido (%d errores):\n", path, len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "  - %s\n", e.Error())
+	}
+}
+
+// SignReceipt returns the content of receipt signed with the certificate
+// configured with --cert
+func SignReceipt(receipt io.Reader) (io.Reader, error) {
+	cert, err := cmd.LoadSigningCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	return SignReceiptWith(receipt, cert)
+}
+
+// SignReceiptWith signs the receipt with an already loaded certificate, to
+// sign several receipts without reading it each time
+func SignReceiptWith(receipt io.Reader, cert *firma.Certificate) (io.Reader, error) {
+	content, err := io.ReadAll(receipt)
+	if err != nil {
+		return nil, fmt.Errorf("error reading receipt: %w", err)
+	}
+
+	signed, err := firma.Sign(content, cert, firma.SignOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error signing receipt: %w", err)
+	}
+
+	return bytes.NewReader(signed), nil
+}
@@ -1,7 +1,6 @@
 package consultar
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,23 +21,12 @@ var ConsultarCmd = &cobra.Command{
 Descarga la guia enviada y en caso de error genera un archivo {numGuia_error.txt}`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		s := sunat.Sunat{Logger: root.GetLogger()}
+		s := root.NewSunat()
 		ticket := args[0]
 
-		token, err := s.GetToken(root.ConfigData.AuthBaseURL, sunat.AuthParams{
-			ClientID:     root.ConfigData.ClientID,
-			ClientSecret: root.ConfigData.ClientSecret,
-			Password:     root.ConfigData.Password,
-			Username:     root.ConfigData.User,
-		})
+		receipt, err := s.GetReceipt(cmd.Context(), root.ConfigData.BaseURL, ticket)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-
-		receipt, err := s.GetReceipt(context.Background(), root.ConfigData.BaseURL, token, ticket)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			root.PrintError(err)
 			os.Exit(1)
 		}
 
@@ -66,6 +54,7 @@ Descarga la guia enviada y en caso de error genera un archivo {numGuia_error.txt
 
 func init() {
 	comprobante.ComprobanteCmd.AddCommand(ConsultarCmd)
+	root.TicketCmd = ConsultarCmd
 
 	ConsultarCmd.Flags().StringVarP(&outputFolder, "output-folder", "o", ".", "Output folder where to save the receipt. Defaults to current folder.")
 	ConsultarCmd.Flags().StringVarP(&errorFolder, "error-folder", "e", ".", "Carpeta donde guardar el mensaje de error si es que sucede un error")
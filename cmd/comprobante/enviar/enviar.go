@@ -6,7 +6,6 @@ import (
 
 	root "github.com/haguirrear/sunatapi/cmd"
 	"github.com/haguirrear/sunatapi/cmd/comprobante"
-	"github.com/haguirrear/sunatapi/pkg/sunat"
 	"github.com/spf13/cobra"
 )
 
@@ -15,10 +14,18 @@ var EnviarCmd = &cobra.Command{
 	Short: "Envía un comprobante (XML) a SUNAT usando la API REST",
 	Long: `Envía un comprobante (XML) a SUNAT usando la API REST. 
 El archivo XML debe tener el nombre de acuerdo al formato establecido por SUNAT
+(RUC-TIPO-SERIE-CORRELATIVO.xml) y coincidir con el contenido del XML.
+Con --nombre-desde-xml el nombre se obtiene del contenido del XML.
+Antes de enviarlo se valida la estructura del XML y su firma digital, use
+--skip-validation y --skip-signature-check para omitirlo.
+Un comprobante aceptado o pendiente de respuesta no se vuelve a enviar, use
+--force para enviarlo de todos modos.
 	`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		s := sunat.Sunat{Logger: root.GetLogger()}
+		s := root.NewSunat()
+		s.SkipSignatureCheck = skipSignatureCheck
+		s.ForceSend = force
 		receipPath := args[0]
 		rFile, err := os.Open(receipPath)
 		defer rFile.Close()
@@ -28,20 +35,22 @@ El archivo XML debe tener el nombre de acuerdo al formato establecido por SUNAT
 			os.Exit(1)
 		}
 
-		token, err := s.GetToken(root.ConfigData.AuthBaseURL, sunat.AuthParams{
-			ClientID:     root.ConfigData.ClientID,
-			ClientSecret: root.ConfigData.ClientSecret,
-			Password:     root.ConfigData.Password,
-			Username:     root.ConfigData.User,
-		})
+		if !skipValidation {
+			if err := comprobante.ValidateReceipt(receipPath); err != nil {
+				comprobante.PrintValidationErrors(receipPath, err)
+				os.Exit(1)
+			}
+		}
+
+		receiptName, err := comprobante.ReceiptName(receipPath, nameFromXML)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 
-		ticket, err := s.ZipAndSendReceipt(root.ConfigData.BaseURL, token, receipPath, rFile)
+		ticket, err := s.ZipAndSendReceipt(cmd.Context(), root.ConfigData.BaseURL, receiptName, rFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			root.PrintError(err)
 			os.Exit(1)
 		}
 
@@ -50,6 +59,15 @@ El archivo XML debe tener el nombre de acuerdo al formato establecido por SUNAT
 	},
 }
 
+var nameFromXML bool
+var skipValidation bool
+var skipSignatureCheck bool
+var force bool
+
 func init() {
 	comprobante.ComprobanteCmd.AddCommand(EnviarCmd)
+	EnviarCmd.Flags().BoolVar(&nameFromXML, "nombre-desde-xml", false, "Obtener el nombre del comprobante (RUC, tipo, serie y correlativo) del contenido del XML en lugar del nombre del archivo")
+	EnviarCmd.Flags().BoolVar(&skipValidation, "skip-validation", false, "No validar la estructura del XML antes de enviarlo")
+	EnviarCmd.Flags().BoolVar(&force, "force", false, "Enviar el comprobante aunque ya haya sido enviado antes")
+	EnviarCmd.Flags().BoolVar(&skipSignatureCheck, "skip-signature-check", false, "No verificar la firma digital del XML antes de enviarlo")
 }
@@ -0,0 +1,63 @@
+package firmar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	root "github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/comprobante"
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+	"github.com/spf13/cobra"
+)
+
+var outputFolder string
+
+var FirmarCmd = &cobra.Command{
+	Use:   "firmar [flags] <ruta recibo>",
+	Short: "Firma digitalmente un comprobante (XML) con el certificado digital",
+	Long: `Firma digitalmente un comprobante (XML) con el certificado digital indicado en --cert.
+
+La firma (XMLDSig enveloped, RSA-SHA256) se agrega dentro de ext:UBLExtensions.
+El comprobante firmado se guarda con el mismo nombre en la carpeta de salida.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		receipPath := args[0]
+
+		cert, err := root.LoadSigningCertificate()
+		if err != nil {
+			root.PrintError(err)
+			os.Exit(1)
+		}
+
+		content, err := os.ReadFile(receipPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		signed, err := firma.Sign(content, cert, firma.SignOptions{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error signing %s: %v\n", receipPath, err)
+			os.Exit(1)
+		}
+
+		if err := os.MkdirAll(outputFolder, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "error ensuring output folder exists: %v\n", err)
+			os.Exit(1)
+		}
+
+		outPath := filepath.Join(outputFolder, filepath.Base(receipPath))
+		if err := os.WriteFile(outPath, signed, 0664); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing signed receipt: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Comprobante firmado guardado en: %s\n", outPath)
+	},
+}
+
+func init() {
+	comprobante.ComprobanteCmd.AddCommand(FirmarCmd)
+	FirmarCmd.Flags().StringVarP(&outputFolder, "output-folder", "o", "firmados", "Carpeta donde guardar el comprobante firmado")
+}
@@ -0,0 +1,424 @@
+package lote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	root "github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/comprobante"
+	"github.com/spf13/cobra"
+)
+
+var workers int
+var outputFolder string
+var processedFolder string
+var errorFolder string
+var resultsFile string
+var retryFailed bool
+var pollTimeout time.Duration
+var nameFromXML bool
+var sign bool
+var skipValidation bool
+var skipSignatureCheck bool
+var force bool
+
+// Report is the content of the results file
+type Report struct {
+	StartedAt  time.Time                   `json:"started_at"`
+	FinishedAt time.Time                   `json:"finished_at"`
+	Total      int                         `json:"total"`
+	Accepted   int                         `json:"accepted"`
+	Rejected   int                         `json:"rejected"`
+	Errors     int                         `json:"errors"`
+	Results    []comprobante.ProcessResult `json:"results"`
+}
+
+var LoteCmd = &cobra.Command{
+	Use:   "lote [flags] <carpeta|patrón|archivo>...",
+	Short: "Envia y consulta varios comprobantes en paralelo",
+	Long: `Envia y consulta varios comprobantes (XML) usando un mismo token de SUNAT.
+
+Los argumentos pueden ser carpetas (se procesan los *.xml que contienen), patrones
+como 'comprobantes/*-09-*.xml' o archivos. Los comprobantes se procesan en paralelo
+con --workers envíos simultáneos, respetando los límites de --rate-limit-*.
+
+Cada comprobante se mueve a la carpeta de procesados si SUNAT lo acepta, o a la
+carpeta de errores junto a un archivo {codComprobante_error.txt} si es rechazado
+o falla. Los CDR se guardan en --output-folder.
+
+Al terminar se muestra un resumen y se escribe el resultado de cada comprobante
+en el archivo de resultados (JSON). Con --reintentar-fallidos se vuelven a
+procesar solo los comprobantes que fallaron según ese archivo.
+
+Los comprobantes ya enviados con el mismo contenido no se vuelven a enviar, se consulta
+el ticket del envío anterior. Use --force para enviarlos de todos modos.`,
+	Example: `  sunat comprobante lote comprobantes/
+  sunat comprobante lote 'comprobantes/*-09-*.xml' --workers 8 --firmar
+  sunat comprobante lote --reintentar-fallidos`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+
+		var previous *Report
+		var files []string
+		var err error
+
+		if retryFailed {
+			previous, err = readReport(resultsFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			files = failedFiles(previous)
+		} else {
+			if len(args) == 0 {
+				fmt.Fprintln(os.Stderr, "error: indique al menos una carpeta, patrón o archivo")
+				os.Exit(1)
+			}
+			files, err = collectFiles(args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if len(files) == 0 {
+			fmt.Println("No hay comprobantes para procesar")
+			return
+		}
+
+		opts := comprobante.ProcessOptions{
+			SkipValidation: skipValidation,
+			NameFromXML:    nameFromXML,
+			PollTimeout:    pollTimeout,
+			OutputFolder:   outputFolder,
+		}
+
+		if sign {
+			opts.Certificate, err = root.LoadSigningCertificate()
+			if err != nil {
+				root.PrintError(err)
+				os.Exit(1)
+			}
+		}
+
+		s := root.NewSunat()
+		s.SkipSignatureCheck = skipSignatureCheck
+		s.ForceSend = force
+
+		// The token is obtained once before starting, so an authentication
+		// problem is reported once instead of for every receipt
+		if _, err := s.Tokens.Token(ctx); err != nil {
+			root.PrintError(err)
+			os.Exit(1)
+		}
+
+		process := func(ctx context.Context, path string) comprobante.ProcessResult {
+			result := comprobante.ProcessReceipt(ctx, s, path, opts)
+			if err := comprobante.MoveResult(&result, processedFolder, errorFolder); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+
+			return result
+		}
+
+		report := Report{StartedAt: time.Now()}
+		report.Results = processFiles(ctx, files, workers, process)
+		report.FinishedAt = time.Now()
+
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "Proceso interrumpido, %d de %d comprobantes procesados\n", len(report.Results), len(files))
+		}
+
+		printSummary(report.Results)
+
+		if previous != nil {
+			report = mergeReports(*previous, report)
+		}
+		report.count()
+
+		if err := writeReport(resultsFile, report); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Resultados guardados en: %s\n", resultsFile)
+		root.CloseHAR()
+
+		for _, r := range report.Results {
+			if r.Failed() {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// collectFiles expands the directories and patterns in args into the list
+// of XML files to process, without duplicates
+func collectFiles(args []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", arg, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+
+			if !info.IsDir() {
+				add(m)
+				continue
+			}
+
+			entries, err := os.ReadDir(m)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range entries {
+				if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".xml") {
+					add(filepath.Join(m, e.Name()))
+				}
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// processFiles runs process for each file with a pool of n workers. When ctx
+// is cancelled no more files are started, the results of the ones processed
+// until then are returned in the order of files.
+func processFiles(ctx context.Context, files []string, n int, process func(ctx context.Context, path string) comprobante.ProcessResult) []comprobante.ProcessResult {
+	if n < 1 {
+		n = 1
+	}
+
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var results []comprobante.ProcessResult
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				result := process(ctx, path)
+
+				mu.Lock()
+				results = append(results, result)
+				fmt.Printf("[%d/%d] %s: %s\n", len(results), len(files), filepath.Base(path), result.Status)
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for _, f := range files {
+		// select picks at random when both are ready
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- f:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Keeps the order of the input, not the one in which they finished
+	order := map[string]int{}
+	for i, f := range files {
+		order[f] = i
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return order[results[i].File] < order[results[j].File]
+	})
+
+	return results
+}
+
+func printSummary(results []comprobante.ProcessResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCHIVO\tESTADO\tTICKET\tDETALLE")
+
+	var accepted, rejected, failed int
+	for _, r := range results {
+		switch r.Status {
+		case comprobante.StatusAccepted:
+			accepted++
+		case comprobante.StatusRejected:
+			rejected++
+		default:
+			failed++
+		}
+
+		detail := r.Message
+		if r.Code != "" {
+			detail = fmt.Sprintf("[%s] %s", r.Code, r.Message)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", filepath.Base(r.File), r.Status, r.Ticket, truncate(detail, 80))
+	}
+	w.Flush()
+
+	fmt.Printf("\nTotal: %d | Aceptados: %d | Rechazados: %d | Errores: %d\n", len(results), accepted, rejected, failed)
+}
+
+func truncate(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) <= max {
+		return s
+	}
+
+	return string([]rune(s)[:max-3]) + "..."
+}
+
+func (r *Report) count() {
+	r.Total = len(r.Results)
+	r.Accepted, r.Rejected, r.Errors = 0, 0, 0
+	for _, res := range r.Results {
+		switch res.Status {
+		case comprobante.StatusAccepted:
+			r.Accepted++
+		case comprobante.StatusRejected:
+			r.Rejected++
+		default:
+			r.Errors++
+		}
+	}
+}
+
+func readReport(path string) (*Report, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("results file %s not found, run the batch without --reintentar-fallidos first", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading results file: %w", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, fmt.Errorf("error parsing results file %s: %w", path, err)
+	}
+
+	return &report, nil
+}
+
+// writeReport writes the report to a temporary file first, so an
+// interrupted write does not lose the previous results
+func writeReport(path string, report Report) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding results: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error ensuring results folder exists: %w", err)
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0664); err != nil {
+		return fmt.Errorf("error writing results file: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing results file: %w", err)
+	}
+
+	return nil
+}
+
+// currentPath is where the file of a previous result is now
+func currentPath(r comprobante.ProcessResult) string {
+	if r.MovedTo != "" {
+		return r.MovedTo
+	}
+
+	return r.File
+}
+
+func failedFiles(report *Report) []string {
+	var files []string
+	for _, r := range report.Results {
+		if r.Failed() {
+			files = append(files, currentPath(r))
+		}
+	}
+
+	return files
+}
+
+// mergeReports replaces the results of previous with the ones retried in
+// retry, the ones not retried (e.g. after Ctrl+C) are kept
+func mergeReports(previous, retry Report) Report {
+	retried := map[string]comprobante.ProcessResult{}
+	for _, r := range retry.Results {
+		retried[r.File] = r
+	}
+
+	merged := Report{StartedAt: previous.StartedAt, FinishedAt: retry.FinishedAt}
+	for _, r := range previous.Results {
+		if newResult, ok := retried[currentPath(r)]; ok && r.Failed() {
+			// Keeps the original location to be able to trace the file
+			newResult.File = r.File
+			r = newResult
+		}
+		merged.Results = append(merged.Results, r)
+	}
+
+	return merged
+}
+
+func init() {
+	comprobante.ComprobanteCmd.AddCommand(LoteCmd)
+	LoteCmd.Flags().IntVarP(&workers, "workers", "w", 4, "Cantidad de comprobantes que se procesan en paralelo")
+	LoteCmd.Flags().StringVarP(&outputFolder, "output-folder", "o", ".", "Carpeta donde guardar los CDR de SUNAT")
+	LoteCmd.Flags().StringVar(&processedFolder, "processed-folder", "procesados", "Carpeta a la que se mueven los comprobantes aceptados")
+	LoteCmd.Flags().StringVarP(&errorFolder, "error-folder", "e", "errores", "Carpeta a la que se mueven los comprobantes rechazados o con error, junto al detalle del error")
+	LoteCmd.Flags().StringVarP(&resultsFile, "results", "r", "lote-resultados.json", "Archivo JSON donde guardar el resultado de cada comprobante")
+	LoteCmd.Flags().BoolVar(&retryFailed, "reintentar-fallidos", false, "Volver a procesar solo los comprobantes que fallaron según el archivo de resultados")
+	LoteCmd.Flags().DurationVar(&pollTimeout, "poll-timeout", 30*time.Second, "Tiempo máximo de espera de la respuesta de SUNAT por comprobante")
+	LoteCmd.Flags().BoolVar(&nameFromXML, "nombre-desde-xml", false, "Obtener el nombre del comprobante (RUC, tipo, serie y correlativo) del contenido del XML en lugar del nombre del archivo")
+	LoteCmd.Flags().BoolVar(&sign, "firmar", false, "Firmar los comprobantes con el certificado digital (--cert) antes de enviarlos")
+	LoteCmd.Flags().BoolVar(&force, "force", false, "Enviar los comprobantes aunque ya hayan sido enviados antes")
+	LoteCmd.Flags().BoolVar(&skipValidation, "skip-validation", false, "No validar la estructura del XML antes de enviarlo")
+	LoteCmd.Flags().BoolVar(&skipSignatureCheck, "skip-signature-check", false, "No verificar la firma digital del XML antes de enviarlo")
+}
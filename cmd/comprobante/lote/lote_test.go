@@ -0,0 +1,230 @@
+package lote
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haguirrear/sunatapi/cmd/comprobante"
+)
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.xml", "b.XML", "c.txt", "sub/d.xml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("<xml/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "folder only takes its xml files",
+			args: []string{dir},
+			want: []string{filepath.Join(dir, "a.xml"), filepath.Join(dir, "b.XML")},
+		},
+		{
+			name: "pattern",
+			args: []string{filepath.Join(dir, "*.txt")},
+			want: []string{filepath.Join(dir, "c.txt")},
+		},
+		{
+			name: "duplicates are removed",
+			args: []string{filepath.Join(dir, "a.xml"), dir, dir + "/./a.xml"},
+			want: []string{filepath.Join(dir, "a.xml"), filepath.Join(dir, "b.XML")},
+		},
+		{
+			name:    "no matches",
+			args:    []string{filepath.Join(dir, "*.json")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			args:    []string{filepath.Join(dir, "[")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := collectFiles(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFailedFiles(t *testing.T) {
+	report := &Report{Results: []comprobante.ProcessResult{
+		{File: "in/a.xml", MovedTo: "procesados/a.xml", Status: comprobante.StatusAccepted},
+		{File: "in/b.xml", MovedTo: "errores/b.xml", Status: comprobante.StatusRejected},
+		{File: "in/c.xml", MovedTo: "errores/c.xml", Status: comprobante.StatusError},
+		// The move failed, the file is still where it was
+		{File: "in/d.xml", Status: comprobante.StatusError},
+	}}
+
+	want := []string{"errores/b.xml", "errores/c.xml", "in/d.xml"}
+	if got := failedFiles(report); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestMergeReports(t *testing.T) {
+	started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	finished := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	previous := Report{
+		StartedAt: started,
+		Results: []comprobante.ProcessResult{
+			{File: "in/a.xml", MovedTo: "procesados/a.xml", Status: comprobante.StatusAccepted, Ticket: "1"},
+			{File: "in/b.xml", MovedTo: "errores/b.xml", Status: comprobante.StatusRejected, Ticket: "2", Code: "2335"},
+			{File: "in/c.xml", MovedTo: "errores/c.xml", Status: comprobante.StatusError, Message: "timeout"},
+			{File: "in/d.xml", MovedTo: "errores/d.xml", Status: comprobante.StatusError, Message: "timeout"},
+			{File: "in/e.xml", Status: comprobante.StatusError, Message: "move failed"},
+		},
+	}
+
+	retry := Report{
+		FinishedAt: finished,
+		Results: []comprobante.ProcessResult{
+			{File: "errores/b.xml", MovedTo: "procesados/b.xml", Status: comprobante.StatusAccepted, Ticket: "3"},
+			{File: "errores/c.xml", MovedTo: "errores/c.xml", Status: comprobante.StatusRejected, Ticket: "4", Code: "3244"},
+			// errores/d.xml was not retried, e.g. after Ctrl+C
+			{File: "in/e.xml", MovedTo: "procesados/e.xml", Status: comprobante.StatusAccepted, Ticket: "5"},
+			// An accepted file is never replaced, even if it shows up again
+			{File: "procesados/a.xml", Status: comprobante.StatusError, Message: "not found"},
+		},
+	}
+
+	merged := mergeReports(previous, retry)
+	merged.count()
+
+	want := []comprobante.ProcessResult{
+		{File: "in/a.xml", MovedTo: "procesados/a.xml", Status: comprobante.StatusAccepted, Ticket: "1"},
+		{File: "in/b.xml", MovedTo: "procesados/b.xml", Status: comprobante.StatusAccepted, Ticket: "3"},
+		{File: "in/c.xml", MovedTo: "errores/c.xml", Status: comprobante.StatusRejected, Ticket: "4", Code: "3244"},
+		{File: "in/d.xml", MovedTo: "errores/d.xml", Status: comprobante.StatusError, Message: "timeout"},
+		{File: "in/e.xml", MovedTo: "procesados/e.xml", Status: comprobante.StatusAccepted, Ticket: "5"},
+	}
+
+	if !reflect.DeepEqual(merged.Results, want) {
+		t.Fatalf("expected %+v, got %+v", want, merged.Results)
+	}
+
+	if !merged.StartedAt.Equal(started) || !merged.FinishedAt.Equal(finished) {
+		t.Fatalf("unexpected dates %s - %s", merged.StartedAt, merged.FinishedAt)
+	}
+
+	if merged.Total != 5 || merged.Accepted != 3 || merged.Rejected != 1 || merged.Errors != 1 {
+		t.Fatalf("unexpected counts %+v", merged)
+	}
+
+	// A second retry only takes the ones still failing
+	if got, want := failedFiles(&merged), []string{"errores/c.xml", "errores/d.xml"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestWriteReadReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resultados", "lote.json")
+
+	if _, err := readReport(path); err == nil {
+		t.Fatal("expected error reading missing results file")
+	}
+
+	report := Report{Results: []comprobante.ProcessResult{
+		{File: "in/a.xml", Status: comprobante.StatusRejected, Code: "2335", Message: "error"},
+	}}
+	report.count()
+
+	if err := writeReport(path, report); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("expected temporary file to be removed, got %v", err)
+	}
+
+	got, err := readReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*got, report) {
+		t.Fatalf("expected %+v, got %+v", report, *got)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readReport(path); err == nil {
+		t.Fatal("expected error reading invalid results file")
+	}
+}
+
+func TestProcessFiles(t *testing.T) {
+	files := []string{"a.xml", "b.xml", "c.xml", "d.xml", "e.xml", "f.xml"}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	process := func(ctx context.Context, path string) comprobante.ProcessResult {
+		// Finish in a different order than they were started
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+
+		mu.Lock()
+		calls[path]++
+		mu.Unlock()
+
+		return comprobante.ProcessResult{File: path, Status: comprobante.StatusAccepted}
+	}
+
+	results := processFiles(context.Background(), files, 3, process)
+
+	var got []string
+	for _, r := range results {
+		got = append(got, r.File)
+	}
+
+	if !reflect.DeepEqual(got, files) {
+		t.Fatalf("expected results in input order %v, got %v", files, got)
+	}
+
+	for _, f := range files {
+		if calls[f] != 1 {
+			t.Fatalf("expected %s to be processed once, got %d", f, calls[f])
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if results := processFiles(ctx, files, 3, process); len(results) != 0 {
+		t.Fatalf("expected no file processed after cancel, got %d", len(results))
+	}
+}
@@ -3,7 +3,9 @@ package procesar
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,6 +21,11 @@ import (
 )
 
 var errorFolder string
+var nameFromXML bool
+var skipValidation bool
+var skipSignatureCheck bool
+var sign bool
+var force bool
 var outputFolder string
 var ticketStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#d2ad5f"))
 var errorDetailStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), true).BorderForeground(lipgloss.Color("63")).Padding(1, 3)
@@ -33,10 +40,17 @@ var ProcesarCmd = &cobra.Command{
 	Long: `Envia un comprobante y luego consulta el mismo
 
 Espera un momento a que SUNAT haya procesado el comprobante y luego obtiene la respuesta.
-En caso de éxito guarda el comprobante procesado, en caso de error guarda un archivo {codComprobante_error.txt} con el error`,
+En caso de éxito guarda el comprobante procesado, en caso de error guarda un archivo {codComprobante_error.txt} con el error
+
+Con --firmar el comprobante se firma con el certificado indicado en --cert antes de enviarlo.
+
+Si el mismo comprobante ya fue enviado, se consulta el ticket del envío anterior en lugar de
+enviarlo de nuevo. Use --force para enviarlo de todos modos.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		s := sunat.Sunat{Logger: root.GetLogger()}
+		s := root.NewSunat()
+		s.SkipSignatureCheck = skipSignatureCheck
+		s.ForceSend = force
 		receipPath := args[0]
 		rFile, err := os.Open(receipPath)
 		defer rFile.Close()
@@ -45,25 +59,47 @@ En caso de éxito guarda el comprobante procesado, en caso de error guarda un ar
 			s.Logger.Error(err.Error())
 			os.Exit(1)
 		}
-		token, err := s.GetToken(root.ConfigData.AuthBaseURL, sunat.AuthParams{
-			ClientID:     root.ConfigData.ClientID,
-			ClientSecret: root.ConfigData.ClientSecret,
-			Password:     root.ConfigData.Password,
-			Username:     root.ConfigData.User,
-		})
+		if !skipValidation {
+			if err := comprobante.ValidateReceipt(receipPath); err != nil {
+				comprobante.PrintValidationErrors(receipPath, err)
+				os.Exit(1)
+			}
+		}
+
+		receiptName, err := comprobante.ReceiptName(receipPath, nameFromXML)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			s.Logger.Error(err.Error())
 			os.Exit(1)
 		}
 
-		ticket, err := s.ZipAndSendReceipt(root.ConfigData.BaseURL, token, receipPath, rFile)
+		var receiptFile io.Reader = rFile
+		if sign {
+			receiptFile, err = comprobante.SignReceipt(rFile)
+			if err != nil {
+				s.Logger.Error(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		ticket, err := s.ZipAndSendReceipt(cmd.Context(), root.ConfigData.BaseURL, receiptName, receiptFile)
+
+		// The same receipt was already sent, its ticket is polled instead
+		var alreadySent *sunat.AlreadySentError
+		if errors.As(err, &alreadySent) && alreadySent.SameContent {
+			ticket, err = alreadySent.Record.Ticket, nil
+			fmt.Printf("El comprobante ya fue enviado el %s, se consultará el ticket: %s\n", alreadySent.Record.SentAt.Local().Format(time.DateTime), ticketStyle.Render(ticket))
+		} else if err == nil {
+			fmt.Println("Recibo enviado correctamente!")
+			fmt.Printf("Se generó el ticket: %s\n", ticketStyle.Render(ticket))
+		}
+
 		if err != nil {
-			s.Logger.Error(err.Error())
+			logError(s, err)
 			os.Exit(1)
 		}
 
-		fmt.Println("Recibo enviado correctamente!")
-		fmt.Printf("Se generó el ticket: %s\n", ticketStyle.Render(ticket))
+		ctx, cancel := context.WithTimeout(cmd.Context(), pollTimeout)
+		defer cancel()
 
 		var spinnerProgram *tea.Program
 		if root.VerboseCount == 0 {
@@ -73,16 +109,22 @@ En caso de éxito guarda el comprobante procesado, en caso de error guarda un ar
 				if _, err := spinnerProgram.Run(); err != nil {
 					cobra.CheckErr(err)
 				}
+
+				// The spinner only stops by itself on Ctrl+C, as the terminal
+				// is in raw mode no signal is received
+				cancel()
 			}()
 		} else {
 			s.Logger.Print("El comprobante está siendo procesado por SUNAT...")
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
-		defer cancel()
+		// Gives SUNAT some time to process the receipt before asking for it
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+		}
 
-		time.Sleep(2 * time.Second)
-		receipt, err := s.PollReceipt(ctx, root.ConfigData.BaseURL, token, ticket)
+		receipt, err := s.PollReceipt(ctx, root.ConfigData.BaseURL, ticket)
 
 		if root.VerboseCount == 0 {
 			if err := spinnerProgram.ReleaseTerminal(); err != nil {
@@ -91,7 +133,7 @@ En caso de éxito guarda el comprobante procesado, en caso de error guarda un ar
 		}
 
 		if err != nil {
-			s.Logger.Error(err.Error())
+			logError(s, err)
 			os.Exit(1)
 		}
 
@@ -102,7 +144,7 @@ En caso de éxito guarda el comprobante procesado, en caso de error guarda un ar
 			s.Logger.Error(errorLine)
 			s.Logger.ClearIndentation()
 
-			receiptFileName := strings.Split(filepath.Base(receipPath), ".")[0]
+			receiptFileName := strings.TrimSuffix(filepath.Base(receiptName), filepath.Ext(receiptName))
 			errorFileName := fmt.Sprintf("%s_error.txt", receiptFileName)
 			errorFileName = filepath.Join(errorFolder, errorFileName)
 			errorAbs, err := filepath.Abs(errorFileName)
@@ -144,8 +186,31 @@ En caso de éxito guarda el comprobante procesado, en caso de error guarda un ar
 	},
 }
 
+// logError logs err followed by the errors detailed by SUNAT and a hint
+// to solve it, if any
+func logError(s sunat.Sunat, err error) {
+	s.Logger.Error(err.Error())
+
+	if details := root.ErrorDetails(err); len(details) > 0 {
+		s.Logger.SetIndentation(1)
+		for _, d := range details {
+			s.Logger.Error(errorDetailStyle.Render(d))
+		}
+		s.Logger.ClearIndentation()
+	}
+
+	if hint := root.ErrorHint(err); hint != "" {
+		s.Logger.Print(hint)
+	}
+}
+
 func init() {
 	comprobante.ComprobanteCmd.AddCommand(ProcesarCmd)
 	ProcesarCmd.Flags().StringVarP(&outputFolder, "output-folder", "o", ".", "Carpeta donde guardar el ticket de SUNAT. Si no es proporcionada se guardará en la carpeta actual")
 	ProcesarCmd.Flags().StringVarP(&errorFolder, "error-folder", "e", ".", "Carpeta donde guardar el mensaje de error si es que sucede un error")
+	ProcesarCmd.Flags().BoolVar(&nameFromXML, "nombre-desde-xml", false, "Obtener el nombre del comprobante (RUC, tipo, serie y correlativo) del contenido del XML en lugar del nombre del archivo")
+	ProcesarCmd.Flags().BoolVar(&sign, "firmar", false, "Firmar el comprobante con el certificado digital (--cert) antes de enviarlo")
+	ProcesarCmd.Flags().BoolVar(&force, "force", false, "Enviar el comprobante aunque ya haya sido enviado antes")
+	ProcesarCmd.Flags().BoolVar(&skipValidation, "skip-validation", false, "No validar la estructura del XML antes de enviarlo")
+	ProcesarCmd.Flags().BoolVar(&skipSignatureCheck, "skip-signature-check", false, "No verificar la firma digital del XML antes de enviarlo")
 }
@@ -0,0 +1,244 @@
+package comprobante
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+)
+
+type ReceiptStatus string
+
+const (
+	// SUNAT accepted the receipt and returned the CDR
+	StatusAccepted ReceiptStatus = "aceptado"
+	// SUNAT processed the receipt and rejected it
+	StatusRejected ReceiptStatus = "rechazado"
+	// The receipt could not be sent or its result could not be obtained
+	StatusError ReceiptStatus = "error"
+)
+
+// initialPollDelay gives SUNAT some time to process the receipt before
+// asking for it
+const initialPollDelay = 2 * time.Second
+
+type ProcessOptions struct {
+	SkipValidation bool
+	NameFromXML    bool
+	// Certificate used to sign the receipts before sending them, they are
+	// sent as they are if nil
+	Certificate *firma.Certificate
+	PollTimeout time.Duration
+	// Folder where the CDR is saved
+	OutputFolder string
+}
+
+// ProcessResult is the outcome of sending and polling one receipt
+type ProcessResult struct {
+	File       string        `json:"file"`
+	MovedTo    string        `json:"moved_to,omitempty"`
+	Document   string        `json:"document,omitempty"`
+	Ticket     string        `json:"ticket,omitempty"`
+	Status     ReceiptStatus `json:"status"`
+	Code       string        `json:"code,omitempty"`
+	Message    string        `json:"message,omitempty"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
+
+func (r ProcessResult) Failed() bool {
+	return r.Status != StatusAccepted
+}
+
+// ProcessReceipt validates, optionally signs, sends and polls the receipt
+// in path, saving the CDR in opts.OutputFolder. Errors are reported in the
+// result. If s.SendLog says the receipt was already sent with the same
+// content, its previous ticket is polled instead.
+func ProcessReceipt(ctx context.Context, s sunat.Sunat, path string, opts ProcessOptions) ProcessResult {
+	result := ProcessResult{File: path}
+	result = processReceipt(ctx, s, path, opts, result)
+	result.FinishedAt = time.Now()
+
+	return result
+}
+
+func processReceipt(ctx context.Context, s sunat.Sunat, path string, opts ProcessOptions, result ProcessResult) ProcessResult {
+	fail := func(err error) ProcessResult {
+		result.Status = StatusError
+		result.Message = err.Error()
+		if hint := cmd.ErrorHint(err); hint != "" {
+			result.Message += ". " + hint
+		}
+		return result
+	}
+
+	if !opts.SkipValidation {
+		if err := ValidateReceipt(path); err != nil {
+			return fail(err)
+		}
+	}
+
+	receiptName, err := ReceiptName(path, opts.NameFromXML)
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Document = strings.TrimSuffix(filepath.Base(receiptName), filepath.Ext(receiptName))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fail(err)
+	}
+	defer f.Close()
+
+	var receiptFile io.Reader = f
+	if opts.Certificate != nil {
+		receiptFile, err = SignReceiptWith(f, opts.Certificate)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	ticket, err := s.ZipAndSendReceipt(ctx, cmd.ConfigData.BaseURL, receiptName, receiptFile)
+
+	var alreadySent *sunat.AlreadySentError
+	if errors.As(err, &alreadySent) && alreadySent.SameContent {
+		s.Logger.Infof("%s ya fue enviado con el ticket %s, consultando su resultado", result.Document, alreadySent.Record.Ticket)
+		ticket, err = alreadySent.Record.Ticket, nil
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Ticket = ticket
+
+	pollCtx, cancel := context.WithTimeout(ctx, opts.PollTimeout)
+	defer cancel()
+
+	select {
+	case <-pollCtx.Done():
+	case <-time.After(initialPollDelay):
+	}
+
+	receipt, err := s.PollReceipt(pollCtx, cmd.ConfigData.BaseURL, ticket)
+	if err != nil {
+		return fail(err)
+	}
+
+	if receipt.ReceiptCertificate != "" {
+		if err := sunat.SaveReceipt(receipt.ReceiptCertificate, opts.OutputFolder); err != nil {
+			return fail(err)
+		}
+	}
+
+	if receipt.IsError() {
+		result.Status = StatusRejected
+		result.Code = receipt.Error.NumError
+		result.Message = receipt.Error.Detail
+		return result
+	}
+
+	if receipt.ReceiptCertificate == "" {
+		result.Status = StatusError
+		result.Code = receipt.ResponseCode
+		result.Message = "SUNAT devolvió un CDR vacío"
+		return result
+	}
+
+	result.Status = StatusAccepted
+	return result
+}
+
+// MoveResult moves the receipt of result to processedFolder if it was
+// accepted, or to errorFolder with its error file otherwise. result.MovedTo
+// is updated with the new path.
+func MoveResult(result *ProcessResult, processedFolder, errorFolder string) error {
+	var errFile error
+	folder := processedFolder
+	if result.Failed() {
+		folder = errorFolder
+		if err := WriteErrorFile(*result, errorFolder); err != nil {
+			errFile = fmt.Errorf("error writing error file of %s: %w", result.File, err)
+		}
+	} else {
+		// The error file of a previous attempt no longer applies
+		RemoveErrorFile(*result, errorFolder)
+	}
+
+	dest, err := MoveReceipt(result.File, folder)
+	if err != nil {
+		return errors.Join(errFile, err)
+	}
+
+	result.MovedTo = dest
+
+	return errFile
+}
+
+// MoveReceipt moves the file in path to folder, keeping its name, and
+// returns its new path
+func MoveReceipt(path, folder string) (string, error) {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return "", fmt.Errorf("error ensuring folder %s exists: %w", folder, err)
+	}
+
+	dest := filepath.Join(folder, filepath.Base(path))
+	if err := os.Rename(path, dest); err == nil {
+		return dest, nil
+	}
+
+	// Rename fails between different volumes
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error moving %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(dest, content, 0664); err != nil {
+		return "", fmt.Errorf("error moving %s: %w", path, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("error moving %s: %w", path, err)
+	}
+
+	return dest, nil
+}
+
+func errorFileName(result ProcessResult) string {
+	name := result.Document
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(result.File), filepath.Ext(result.File))
+	}
+
+	return name + "_error.txt"
+}
+
+// WriteErrorFile saves the detail of a failed result as
+// {documento}_error.txt in folder, like procesar does
+func WriteErrorFile(result ProcessResult, folder string) error {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return fmt.Errorf("error ensuring error folder exists: %w", err)
+	}
+
+	content := fmt.Sprintf("Error Code: %s | Detail: %s", result.Code, result.Message)
+
+	return os.WriteFile(filepath.Join(folder, errorFileName(result)), []byte(content), 0664)
+}
+
+// RemoveErrorFile removes the error file written by WriteErrorFile in a
+// previous attempt, if any
+func RemoveErrorFile(result ProcessResult, folder string) {
+	os.Remove(filepath.Join(folder, errorFileName(result)))
+	if result.Document != "" {
+		// The error may have been saved before the document name was known
+		os.Remove(filepath.Join(folder, errorFileName(ProcessResult{File: result.File})))
+	}
+}
@@ -0,0 +1,98 @@
+package comprobante
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		result ProcessResult
+		// Folder where the receipt is expected
+		wantFolder string
+		// Error file expected in the error folder, empty if none
+		wantErrorFile string
+	}{
+		{
+			name:       "accepted",
+			result:     ProcessResult{Document: "20123456789-09-T001-1", Status: StatusAccepted},
+			wantFolder: "procesados",
+		},
+		{
+			name:          "rejected",
+			result:        ProcessResult{Document: "20123456789-09-T001-1", Status: StatusRejected, Code: "2335", Message: "El documento no es válido"},
+			wantFolder:    "errores",
+			wantErrorFile: "20123456789-09-T001-1_error.txt",
+		},
+		{
+			name:          "error before reading the document",
+			result:        ProcessResult{Status: StatusError, Message: "invalid xml"},
+			wantFolder:    "errores",
+			wantErrorFile: "guia_error.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			processed, errFolder := filepath.Join(dir, "procesados"), filepath.Join(dir, "errores")
+
+			path := filepath.Join(dir, "guia.xml")
+			if err := os.WriteFile(path, []byte("<DespatchAdvice/>"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Error files of a previous attempt
+			if err := os.MkdirAll(errFolder, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"guia_error.txt", "20123456789-09-T001-1_error.txt"} {
+				if err := os.WriteFile(filepath.Join(errFolder, name), []byte("old"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result := tt.result
+			result.File = path
+			if err := MoveResult(&result, processed, errFolder); err != nil {
+				t.Fatal(err)
+			}
+
+			want := filepath.Join(dir, tt.wantFolder, "guia.xml")
+			if result.MovedTo != want {
+				t.Fatalf("expected MovedTo %s, got %s", want, result.MovedTo)
+			}
+
+			if _, err := os.Stat(want); err != nil {
+				t.Fatalf("expected receipt in %s: %v", want, err)
+			}
+
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("expected receipt to be moved from %s, got %v", path, err)
+			}
+
+			if tt.wantErrorFile == "" {
+				entries, err := os.ReadDir(errFolder)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 0 {
+					t.Fatalf("expected stale error files to be removed, got %d files", len(entries))
+				}
+				return
+			}
+
+			content, err := os.ReadFile(filepath.Join(errFolder, tt.wantErrorFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantContent := "Error Code: " + tt.result.Code + " | Detail: " + tt.result.Message
+			if string(content) != wantContent {
+				t.Fatalf("expected error file '%s', got '%s'", wantContent, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package validar
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/haguirrear/sunatapi/cmd/comprobante"
+	"github.com/spf13/cobra"
+)
+
+var ValidarCmd = &cobra.Command{
+	Use:   "validar <ruta recibo>",
+	Short: "Valida la estructura de una guía de remisión (XML) sin enviarla a SUNAT",
+	Long: `Valida la estructura de una guía de remisión electrónica (UBL 2.1 DespatchAdvice)
+sin enviarla a SUNAT.
+
+Verifica que el XML esté bien formado, el elemento raíz y los namespaces,
+UBLVersionID y CustomizationID, y que los elementos obligatorios estén presentes
+con la cardinalidad correcta. Cada error indica la línea y la ruta (XPath) del elemento.
+No reemplaza la validación de SUNAT, solo detecta los errores más comunes.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		receipPath := args[0]
+
+		if err := comprobante.ValidateReceipt(receipPath); err != nil {
+			comprobante.PrintValidationErrors(receipPath, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("El comprobante %s es válido\n", receipPath)
+	},
+}
+
+func init() {
+	comprobante.ComprobanteCmd.AddCommand(ValidarCmd)
+}
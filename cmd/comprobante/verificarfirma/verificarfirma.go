@@ -0,0 +1,58 @@
+package verificarfirma
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	root "github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/comprobante"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+	"github.com/spf13/cobra"
+)
+
+var VerificarFirmaCmd = &cobra.Command{
+	Use:   "verificar-firma <ruta recibo>",
+	Short: "Verifica la firma digital de un comprobante (XML) sin enviarlo a SUNAT",
+	Long: `Verifica la firma digital (ds:Signature) de un comprobante sin enviarlo a SUNAT.
+
+Se verifica el digest de la referencia (que el XML no fue modificado después de
+firmarlo), el valor de la firma, el periodo de validez del certificado y que el
+certificado pertenezca al RUC emisor del comprobante.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		receipPath := args[0]
+
+		content, err := os.ReadFile(receipPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The RUC is only checked when the XML includes it
+		docID, _ := sunat.DocumentIDFromXML(bytes.NewReader(content))
+
+		v, err := firma.Verify(content, firma.VerifyOptions{RUC: docID.RUC})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "La firma del comprobante %s no es válida\n", receipPath)
+			root.PrintError(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("La firma del comprobante %s es válida\n", receipPath)
+		fmt.Printf("  Firma:       %s\n", v.SignatureID)
+		fmt.Printf("  Certificado: %s\n", v.Certificate.Subject.String())
+		fmt.Printf("  Emisor:      %s\n", v.Certificate.Issuer.String())
+		fmt.Printf("  Vigencia:    %s - %s\n", v.Certificate.NotBefore.Format(time.DateOnly), v.Certificate.NotAfter.Format(time.DateOnly))
+		if len(v.CertificateRUCs) > 0 {
+			fmt.Printf("  RUC:         %s\n", strings.Join(v.CertificateRUCs, ", "))
+		}
+	},
+}
+
+func init() {
+	comprobante.ComprobanteCmd.AddCommand(VerificarFirmaCmd)
+}
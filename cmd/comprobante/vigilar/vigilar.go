@@ -0,0 +1,389 @@
+package vigilar
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	root "github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/comprobante"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/spf13/cobra"
+)
+
+var workers int
+var outputFolder string
+var processedFolder string
+var errorFolder string
+var stableTime time.Duration
+var scanInterval time.Duration
+var pollTimeout time.Duration
+var shutdownTimeout time.Duration
+var nameFromXML bool
+var sign bool
+var skipValidation bool
+var skipSignatureCheck bool
+
+var VigilarCmd = &cobra.Command{
+	Use:   "vigilar [flags] <carpeta de entrada>",
+	Short: "Vigila una carpeta y envía a SUNAT los comprobantes que se copian en ella",
+	Long: `Vigila una carpeta y procesa (envía y consulta) cada comprobante XML que se copia en ella.
+
+Un archivo se procesa cuando deja de cambiar durante --stable-time, para no enviar
+archivos que aún se están escribiendo. Los comprobantes aceptados se mueven a la
+carpeta de procesados, los rechazados o con error a la carpeta de errores junto a un
+archivo {codComprobante_error.txt}, y los CDR se guardan en --output-folder. Un
+comprobante que no se puede mover no se vuelve a procesar hasta reiniciar el comando.
+
+Los envíos se registran en --send-log-dir: si el proceso se reinicia, los comprobantes
+ya enviados no se vuelven a enviar, se consulta su ticket. Además de los eventos del
+sistema de archivos, la carpeta se revisa cada --scan-interval, ya que las carpetas
+compartidas en red no siempre notifican los cambios.
+
+Con Ctrl+C o SIGTERM deja de tomar comprobantes nuevos y espera hasta --shutdown-timeout
+a que terminen los que están en proceso.`,
+	Example: `  sunat comprobante vigilar bandeja/ --firmar
+  sunat comprobante vigilar //servidor/guias --processed-folder //servidor/procesados`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		inbox := args[0]
+
+		if info, err := os.Stat(inbox); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "error: %s is not a folder\n", inbox)
+			os.Exit(1)
+		}
+
+		opts := comprobante.ProcessOptions{
+			SkipValidation: skipValidation,
+			NameFromXML:    nameFromXML,
+			PollTimeout:    pollTimeout,
+			OutputFolder:   outputFolder,
+		}
+
+		var err error
+		if sign {
+			opts.Certificate, err = root.LoadSigningCertificate()
+			if err != nil {
+				root.PrintError(err)
+				os.Exit(1)
+			}
+		}
+
+		s := root.NewSunat()
+		s.SkipSignatureCheck = skipSignatureCheck
+
+		// Without the send log a restart would send the receipts in process
+		// again
+		if s.SendLog == nil {
+			fmt.Fprintln(os.Stderr, "error: vigilar requires the send log, remove --no-send-log")
+			os.Exit(1)
+		}
+
+		if _, err := s.Tokens.Token(ctx); err != nil {
+			root.PrintError(err)
+			os.Exit(1)
+		}
+
+		w := &watcher{
+			inbox:   inbox,
+			s:       s,
+			opts:    opts,
+			pending: map[string]fileState{},
+			queued:  map[string]bool{},
+			stuck:   map[string]bool{},
+		}
+
+		err = w.run(ctx)
+		root.CloseHAR()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// fileState is the last size and modification time seen of a file, to
+// know when it is completely written
+type fileState struct {
+	size    int64
+	modTime time.Time
+	// Since when the file has not changed
+	since time.Time
+}
+
+type watcher struct {
+	inbox string
+	s     sunat.Sunat
+	opts  comprobante.ProcessOptions
+
+	// Files waiting to be completely written
+	pending map[string]fileState
+	// Files ready or being processed
+	queued map[string]bool
+	ready  []string
+	// Files that could not be moved out of the inbox after processing them
+	stuck map[string]bool
+
+	// Returns the current time, time.Now if nil
+	now func() time.Time
+}
+
+// processed is a receipt that a worker finished
+type processed struct {
+	path  string
+	moved bool
+}
+
+func (w *watcher) clock() time.Time {
+	if w.now == nil {
+		return time.Now()
+	}
+
+	return w.now()
+}
+
+// run watches the inbox until ctx is cancelled, then waits for the receipts
+// in process up to shutdownTimeout
+func (w *watcher) run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating file watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	if err := fsw.Add(w.inbox); err != nil {
+		return fmt.Errorf("error watching %s: %w", w.inbox, err)
+	}
+
+	// The receipts in process are not aborted on Ctrl+C, only after the
+	// shutdown timeout
+	procCtx, cancelProc := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelProc()
+
+	n := workers
+	if n < 1 {
+		n = 1
+	}
+
+	jobs := make(chan string)
+	done := make(chan processed)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				done <- processed{path: path, moved: w.process(procCtx, path)}
+			}
+		}()
+	}
+
+	fmt.Printf("Vigilando %s (Ctrl+C para detener)\n", w.inbox)
+
+	// Files copied while the process was stopped
+	w.scan()
+
+	checkTicker := time.NewTicker(checkInterval())
+	defer checkTicker.Stop()
+	scanTicker := time.NewTicker(scanInterval)
+	defer scanTicker.Stop()
+
+loop:
+	for {
+		// Only sends a job when there is one ready
+		var out chan string
+		var next string
+		if len(w.ready) > 0 {
+			out = jobs
+			next = w.ready[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			break loop
+		case out <- next:
+			w.ready = w.ready[1:]
+		case p := <-done:
+			w.finish(p.path, p.moved)
+		case event, ok := <-fsw.Events:
+			if !ok {
+				break loop
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				w.track(event.Name)
+			}
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				break loop
+			}
+			fmt.Fprintf(os.Stderr, "error watching %s: %v\n", w.inbox, err)
+		case <-checkTicker.C:
+			w.checkPending()
+		case <-scanTicker.C:
+			w.scan()
+		}
+	}
+
+	inProcess := len(w.queued) - len(w.ready)
+	fmt.Printf("Deteniendo, esperando %d comprobantes en proceso...\n", inProcess)
+
+	close(jobs)
+	go func() {
+		for range done {
+		}
+	}()
+
+	timer := time.AfterFunc(shutdownTimeout, cancelProc)
+	defer timer.Stop()
+	wg.Wait()
+	close(done)
+
+	return nil
+}
+
+// checkInterval is how often the pending files are checked
+func checkInterval() time.Duration {
+	interval := stableTime / 4
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+
+	return interval
+}
+
+func isReceipt(path string) bool {
+	name := filepath.Base(path)
+
+	// Hidden and temporary files written by other programs are skipped
+	return !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "~") && strings.EqualFold(filepath.Ext(name), ".xml")
+}
+
+// track starts waiting for path to be completely written
+func (w *watcher) track(path string) {
+	if !isReceipt(path) || w.queued[path] || w.stuck[path] {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	state, ok := w.pending[path]
+	if !ok || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+		w.pending[path] = fileState{size: info.Size(), modTime: info.ModTime(), since: w.clock()}
+	}
+}
+
+// checkPending queues the pending files that did not change during
+// stableTime
+func (w *watcher) checkPending() {
+	now := w.clock()
+	for path, state := range w.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			// Removed or moved by someone else
+			delete(w.pending, path)
+			continue
+		}
+
+		if state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+			w.pending[path] = fileState{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+
+		if info.Size() > 0 && now.Sub(state.since) >= stableTime {
+			delete(w.pending, path)
+			w.queued[path] = true
+			w.ready = append(w.ready, path)
+		}
+	}
+}
+
+// scan tracks the receipts in the inbox, for the changes not notified
+func (w *watcher) scan() {
+	entries, err := os.ReadDir(w.inbox)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading %s: %v\n", w.inbox, err)
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(w.inbox, e.Name())
+		if _, ok := w.pending[path]; !ok {
+			w.track(path)
+		}
+	}
+}
+
+// finish marks the receipt in path as processed. One that could not be
+// moved out of the inbox is not processed again until the next start, or
+// every scan would pick it up.
+func (w *watcher) finish(path string, moved bool) {
+	delete(w.queued, path)
+	if !moved {
+		w.stuck[path] = true
+	}
+}
+
+// process sends and polls the receipt in path and moves it to the processed
+// or error folder. It returns false if the receipt was processed but could
+// not be moved.
+func (w *watcher) process(ctx context.Context, path string) bool {
+	result := comprobante.ProcessReceipt(ctx, w.s, path, w.opts)
+
+	// Interrupted by the shutdown, it stays in the inbox and its ticket is
+	// polled on the next start
+	if ctx.Err() != nil && result.Status == comprobante.StatusError {
+		fmt.Printf("%s %s: interrumpido\n", time.Now().Format(time.DateTime), filepath.Base(path))
+		return true
+	}
+
+	moved := true
+	if err := comprobante.MoveResult(&result, processedFolder, errorFolder); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v, it will not be processed again until vigilar restarts\n", err)
+		moved = false
+	}
+
+	line := fmt.Sprintf("%s %s: %s", time.Now().Format(time.DateTime), filepath.Base(path), result.Status)
+	if result.Ticket != "" {
+		line += fmt.Sprintf(" (ticket %s)", result.Ticket)
+	}
+	if result.Failed() {
+		detail := result.Message
+		if result.Code != "" {
+			detail = fmt.Sprintf("[%s] %s", result.Code, result.Message)
+		}
+		line += " " + detail
+	}
+
+	fmt.Println(line)
+
+	return moved
+}
+
+func init() {
+	comprobante.ComprobanteCmd.AddCommand(VigilarCmd)
+	VigilarCmd.Flags().IntVarP(&workers, "workers", "w", 2, "Cantidad de comprobantes que se procesan en paralelo")
+	VigilarCmd.Flags().StringVarP(&outputFolder, "output-folder", "o", "cdr", "Carpeta donde guardar los CDR de SUNAT")
+	VigilarCmd.Flags().StringVar(&processedFolder, "processed-folder", "procesados", "Carpeta a la que se mueven los comprobantes aceptados")
+	VigilarCmd.Flags().StringVarP(&errorFolder, "error-folder", "e", "errores", "Carpeta a la que se mueven los comprobantes rechazados o con error, junto al detalle del error")
+	VigilarCmd.Flags().DurationVar(&stableTime, "stable-time", 2*time.Second, "Tiempo que un archivo no debe cambiar para considerarlo completamente escrito")
+	VigilarCmd.Flags().DurationVar(&scanInterval, "scan-interval", 30*time.Second, "Cada cuánto revisar la carpeta además de los eventos del sistema de archivos")
+	VigilarCmd.Flags().DurationVar(&pollTimeout, "poll-timeout", 30*time.Second, "Tiempo máximo de espera de la respuesta de SUNAT por comprobante")
+	VigilarCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Tiempo máximo de espera de los comprobantes en proceso al detenerse")
+	VigilarCmd.Flags().BoolVar(&nameFromXML, "nombre-desde-xml", false, "Obtener el nombre del comprobante (RUC, tipo, serie y correlativo) del contenido del XML en lugar del nombre del archivo")
+	VigilarCmd.Flags().BoolVar(&sign, "firmar", false, "Firmar los comprobantes con el certificado digital (--cert) antes de enviarlos")
+	VigilarCmd.Flags().BoolVar(&skipValidation, "skip-validation", false, "No validar la estructura del XML antes de enviarlo")
+	VigilarCmd.Flags().BoolVar(&skipSignatureCheck, "skip-signature-check", false, "No verificar la firma digital del XML antes de enviarlo")
+}
@@ -0,0 +1,209 @@
+package vigilar
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haguirrear/sunatapi/cmd/comprobante"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+)
+
+func newTestWatcher(t *testing.T) *watcher {
+	t.Helper()
+
+	return &watcher{
+		inbox:   t.TempDir(),
+		pending: map[string]fileState{},
+		queued:  map[string]bool{},
+		stuck:   map[string]bool{},
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsReceipt(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"bandeja/20123456789-09-T001-1.xml", true},
+		{"bandeja/20123456789-09-T001-1.XML", true},
+		{"bandeja/.20123456789-09-T001-1.xml", false},
+		{"bandeja/~20123456789-09-T001-1.xml", false},
+		{"bandeja/20123456789-09-T001-1.xml.tmp", false},
+		{"bandeja/20123456789-09-T001-1.zip", false},
+	}
+
+	for _, tt := range tests {
+		if got := isReceipt(tt.path); got != tt.want {
+			t.Errorf("isReceipt(%s): expected %v, got %v", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestScanTracksOnlyReceipts(t *testing.T) {
+	w := newTestWatcher(t)
+
+	writeFile(t, filepath.Join(w.inbox, "a.xml"), "<a/>")
+	writeFile(t, filepath.Join(w.inbox, ".b.xml"), "<b/>")
+	writeFile(t, filepath.Join(w.inbox, "~c.xml"), "<c/>")
+	writeFile(t, filepath.Join(w.inbox, "d.txt"), "d")
+	if err := os.Mkdir(filepath.Join(w.inbox, "e.xml"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w.scan()
+
+	if len(w.pending) != 1 {
+		t.Fatalf("expected only a.xml to be tracked, got %v", w.pending)
+	}
+
+	if _, ok := w.pending[filepath.Join(w.inbox, "a.xml")]; !ok {
+		t.Fatalf("expected a.xml to be tracked, got %v", w.pending)
+	}
+}
+
+func TestCheckPending(t *testing.T) {
+	previous := stableTime
+	stableTime = 2 * time.Second
+	t.Cleanup(func() { stableTime = previous })
+
+	w := newTestWatcher(t)
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	path := filepath.Join(w.inbox, "a.xml")
+	empty := filepath.Join(w.inbox, "empty.xml")
+	removed := filepath.Join(w.inbox, "removed.xml")
+
+	writeFile(t, path, "<DespatchAdvice>")
+	writeFile(t, empty, "")
+	writeFile(t, removed, "<a/>")
+	w.scan()
+
+	w.checkPending()
+	if len(w.ready) != 0 {
+		t.Fatalf("expected no file ready before the stable time, got %v", w.ready)
+	}
+
+	// Still being written, the stable time starts again
+	now = now.Add(time.Second)
+	writeFile(t, path, "<DespatchAdvice></DespatchAdvice>")
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	w.checkPending()
+
+	if _, ok := w.pending[removed]; ok {
+		t.Fatal("expected removed file to stop being tracked")
+	}
+
+	now = now.Add(time.Second)
+	w.checkPending()
+	if len(w.ready) != 0 {
+		t.Fatalf("expected no file ready after a change, got %v", w.ready)
+	}
+
+	now = now.Add(time.Second)
+	w.checkPending()
+	if len(w.ready) != 1 || w.ready[0] != path || !w.queued[path] {
+		t.Fatalf("expected %s to be ready, got %v", path, w.ready)
+	}
+
+	if _, ok := w.pending[path]; ok {
+		t.Fatal("expected ready file to stop being pending")
+	}
+
+	// Empty files are not sent, they may not have been written yet
+	if _, ok := w.pending[empty]; !ok {
+		t.Fatal("expected empty file to stay pending")
+	}
+
+	// Events of a queued file are ignored, so it is not sent twice
+	w.track(path)
+	if _, ok := w.pending[path]; ok {
+		t.Fatal("expected queued file not to be tracked again")
+	}
+}
+
+func TestProcessMoveFailedIsNotRetried(t *testing.T) {
+	w := newTestWatcher(t)
+	out := t.TempDir()
+
+	// The error folder cannot be created, a file has its name
+	blocked := filepath.Join(out, "errores")
+	writeFile(t, blocked, "")
+
+	previousProcessed, previousError := processedFolder, errorFolder
+	processedFolder, errorFolder = filepath.Join(out, "procesados"), blocked
+	t.Cleanup(func() { processedFolder, errorFolder = previousProcessed, previousError })
+
+	// Fails the validation, before sending it
+	path := filepath.Join(w.inbox, "20123456789-09-T001-1.xml")
+	writeFile(t, path, "<DespatchAdvice>")
+
+	w.s = sunat.Sunat{Tokens: sunat.NewStaticTokenSource("token")}
+	w.opts = comprobante.ProcessOptions{PollTimeout: time.Second, OutputFolder: filepath.Join(out, "cdr")}
+
+	w.queued[path] = true
+	moved := w.process(context.Background(), path)
+	if moved {
+		t.Fatal("expected the move to fail")
+	}
+
+	w.finish(path, moved)
+	if w.queued[path] {
+		t.Fatal("expected the receipt to stop being queued")
+	}
+
+	// The next scan does not pick it up again
+	w.scan()
+	if _, ok := w.pending[path]; ok {
+		t.Fatal("expected a receipt that could not be moved not to be tracked again")
+	}
+}
+
+func TestProcessInterruptedStaysInInbox(t *testing.T) {
+	w := newTestWatcher(t)
+	out := t.TempDir()
+
+	previousProcessed, previousError := processedFolder, errorFolder
+	processedFolder, errorFolder = filepath.Join(out, "procesados"), filepath.Join(out, "errores")
+	t.Cleanup(func() { processedFolder, errorFolder = previousProcessed, previousError })
+
+	content, err := os.ReadFile("../../../pkg/sunat/testdata/20123456789-09-T001-1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(w.inbox, "20123456789-09-T001-1.xml")
+	writeFile(t, path, string(content))
+
+	w.s = sunat.Sunat{Tokens: sunat.NewStaticTokenSource("token"), SkipSignatureCheck: true}
+	w.opts = comprobante.ProcessOptions{SkipValidation: true, PollTimeout: time.Second, OutputFolder: filepath.Join(out, "cdr")}
+
+	// Cancelled by the shutdown timeout while sending
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w.process(ctx, path)
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected receipt to stay in the inbox: %v", err)
+	}
+
+	for _, folder := range []string{processedFolder, errorFolder} {
+		if _, err := os.Stat(folder); !os.IsNotExist(err) {
+			t.Fatalf("expected nothing moved to %s, got %v", folder, err)
+		}
+	}
+}
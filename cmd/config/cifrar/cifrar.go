@@ -0,0 +1,92 @@
+package cifrar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	root "github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/config"
+	"github.com/haguirrear/sunatapi/pkg/vault"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var outputFile string
+var force bool
+var removeSource bool
+
+var CifrarCmd = &cobra.Command{
+	Use:   "cifrar <archivo yaml>",
+	Short: "Cifra un archivo de configuración con credenciales",
+	Long: `Cifra un archivo de configuración YAML con credenciales usando una contraseña.
+El resultado se guarda por defecto en ` + root.DefaultVaultFile,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sourcePath := args[0]
+		plaintext, err := os.ReadFile(sourcePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if vault.IsVault(plaintext) {
+			fmt.Fprintf(os.Stderr, "error: %s ya está cifrado\n", sourcePath)
+			os.Exit(1)
+		}
+
+		check := viper.New()
+		check.SetConfigType("yaml")
+		if err := check.ReadConfig(bytes.NewReader(plaintext)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s no es un YAML válido: %v\n", sourcePath, err)
+			os.Exit(1)
+		}
+
+		if _, err := os.Stat(outputFile); err == nil && !force {
+			fmt.Fprintf(os.Stderr, "error: %s ya existe, use --force para sobreescribirlo\n", outputFile)
+			os.Exit(1)
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		passphrase, err := root.NewVaultPassphrase()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		content, err := vault.Encrypt(plaintext, passphrase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := os.WriteFile(outputFile, content, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Credenciales cifradas en %s\n", outputFile)
+
+		if removeSource {
+			if err := os.Remove(sourcePath); err != nil {
+				fmt.Fprintf(os.Stderr, "error: no se pudo eliminar %s: %v\n", sourcePath, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Se eliminó %s\n", sourcePath)
+		} else {
+			fmt.Printf("Recuerde eliminar las credenciales en texto plano de %s\n", sourcePath)
+		}
+	},
+}
+
+func init() {
+	config.ConfigCmd.AddCommand(CifrarCmd)
+
+	CifrarCmd.Flags().StringVarP(&outputFile, "output", "o", root.DefaultVaultFile, "Archivo cifrado a generar")
+	CifrarCmd.Flags().BoolVar(&force, "force", false, "Sobreescribir el archivo cifrado si ya existe")
+	CifrarCmd.Flags().BoolVar(&removeSource, "remove-source", false, "Eliminar el archivo en texto plano luego de cifrarlo")
+}
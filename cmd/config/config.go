@@ -0,0 +1,23 @@
+package config
+
+import (
+	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/spf13/cobra"
+)
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Administrar el archivo de credenciales cifrado",
+	Long: `Administrar el archivo de credenciales cifrado.
+
+El archivo contiene la configuración en formato YAML (user, password, clientId,
+clientSecret, ...) cifrada con una contraseña. Los comandos que necesitan las credenciales lo leen si
+se indica con --credentials-file o si existe ` + cmd.DefaultVaultFile + ` en la carpeta actual.
+
+La contraseña se pide por la terminal, o se puede definir en la variable
+` + cmd.VaultPassphraseEnv + ` para ejecuciones desatendidas.`,
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(ConfigCmd)
+}
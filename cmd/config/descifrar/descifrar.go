@@ -0,0 +1,68 @@
+package descifrar
+
+import (
+	"fmt"
+	"os"
+
+	root "github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/config"
+	"github.com/haguirrear/sunatapi/pkg/vault"
+	"github.com/spf13/cobra"
+)
+
+var outputFile string
+
+var DescifrarCmd = &cobra.Command{
+	Use:   "descifrar [archivo cifrado]",
+	Short: "Muestra el contenido del archivo de credenciales cifrado",
+	Long: `Muestra el contenido del archivo de credenciales cifrado, o lo guarda en texto
+plano con --output. Si no se indica el archivo se usa el configurado.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultPath := root.CredentialsVaultPath()
+		if len(args) > 0 {
+			vaultPath = args[0]
+		}
+
+		if vaultPath == "" {
+			fmt.Fprintln(os.Stderr, "error: no se encontró un archivo de credenciales cifrado")
+			os.Exit(1)
+		}
+
+		content, err := os.ReadFile(vaultPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		passphrase, err := root.VaultPassphrase()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		plaintext, err := vault.Decrypt(content, passphrase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if outputFile == "" {
+			os.Stdout.Write(plaintext)
+			return
+		}
+
+		if err := os.WriteFile(outputFile, plaintext, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Credenciales descifradas en %s\n", outputFile)
+	},
+}
+
+func init() {
+	config.ConfigCmd.AddCommand(DescifrarCmd)
+
+	DescifrarCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Archivo donde guardar las credenciales en texto plano")
+}
@@ -0,0 +1,151 @@
+package editar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	root "github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/cmd/config"
+	"github.com/haguirrear/sunatapi/pkg/vault"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const template = `# Credenciales para sunatapi
+user: ""
+password: ""
+clientId: ""
+clientSecret: ""
+# certPassword: ""
+`
+
+var EditarCmd = &cobra.Command{
+	Use:   "editar [archivo cifrado]",
+	Short: "Edita el archivo de credenciales cifrado",
+	Long: `Descifra el archivo de credenciales en un archivo temporal, lo abre con el editor
+definido en $VISUAL o $EDITOR y vuelve a cifrarlo al cerrar el editor.
+Si el archivo no existe se crea uno nuevo.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultPath := root.CredentialsVaultPath()
+		if len(args) > 0 {
+			vaultPath = args[0]
+		}
+
+		if vaultPath == "" {
+			vaultPath = root.DefaultVaultFile
+		}
+
+		if err := edit(vaultPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Credenciales guardadas en %s\n", vaultPath)
+	},
+}
+
+func edit(vaultPath string) error {
+	var plaintext []byte
+	var passphrase string
+
+	content, err := os.ReadFile(vaultPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		plaintext = []byte(template)
+		if passphrase, err = root.NewVaultPassphrase(); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		if passphrase, err = root.VaultPassphrase(); err != nil {
+			return err
+		}
+
+		if plaintext, err = vault.Decrypt(content, passphrase); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "sunatapi-*.yaml")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(plaintext); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+
+	editor := editorCmd(editorCommand(), tmp.Name())
+	editor.Stdin = os.Stdin
+	editor.Stdout = os.Stdout
+	editor.Stderr = os.Stderr
+	if err := editor.Run(); err != nil {
+		return fmt.Errorf("error running editor: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("error reading edited file: %w", err)
+	}
+
+	if bytes.Equal(edited, plaintext) && content != nil {
+		return nil
+	}
+
+	check := viper.New()
+	check.SetConfigType("yaml")
+	if err := check.ReadConfig(bytes.NewReader(edited)); err != nil {
+		return fmt.Errorf("edited file is not valid YAML, changes discarded: %w", err)
+	}
+
+	encrypted, err := vault.Encrypt(edited, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(vaultPath, encrypted, 0600)
+}
+
+func editorCommand() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := os.Getenv(env); e != "" {
+			return e
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+
+	return "vi"
+}
+
+// editorCmd returns the command that opens file with editor. The editor may
+// include arguments, e.g. "code --wait", so it is run by the shell.
+func editorCmd(editor, file string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		fields := strings.Fields(editor)
+		return exec.Command(fields[0], append(fields[1:], file)...)
+	}
+
+	// The file is passed as an argument, not inside the script, so its
+	// name is never interpreted by the shell
+	return exec.Command("sh", "-c", editor+` "$1"`, "sh", file)
+}
+
+func init() {
+	config.ConfigCmd.AddCommand(EditarCmd)
+}
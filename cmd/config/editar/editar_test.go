@@ -0,0 +1,33 @@
+package editar
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEditorCmdWithArguments(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	file := filepath.Join(t.TempDir(), "credenciales con espacio.yaml")
+	if err := os.WriteFile(file, []byte("user: \"\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Like "code --wait", an editor with its own arguments
+	if err := editorCmd(`sed -i.bak s/user/edited/`, file).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "edited: \"\"\n" {
+		t.Fatalf("expected the file to be edited, got '%s'", content)
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
+	"github.com/spf13/cobra"
+)
+
+// TicketCmd is the command that obtains the result of a ticket, it is
+// registered by its package and used in the hints to poll a ticket
+var TicketCmd *cobra.Command
+
+// ErrorHint returns an explanation in spanish of what the operator should
+// check to solve err, empty if there is none
+func ErrorHint(err error) string {
+	if hint := signatureErrorHint(err); hint != "" {
+		return hint
+	}
+
+	if hint := sendErrorHint(err); hint != "" {
+		return hint
+	}
+
+	var apiErr *sunat.APIError
+	if errors.As(err, &apiErr) {
+		return apiErrorHint(apiErr)
+	}
+
+	var authErr *sunat.AuthError
+	if !errors.As(err, &authErr) {
+		return ""
+	}
+
+	switch authErr.Kind {
+	case sunat.AuthErrorInvalidCredentials:
+		return "El usuario o la Clave SOL son incorrectos. Verifique el usuario (RUC+Usuario SOL) y la Clave SOL."
+	case sunat.AuthErrorInvalidClient:
+		return "El Client ID o Client Secret no son válidos. Verifique las credenciales de la API generadas en SUNAT Operaciones en Línea."
+	case sunat.AuthErrorDisabledClient:
+		return "Las credenciales de la API están deshabilitadas o fueron revocadas. Genere nuevas credenciales en SUNAT Operaciones en Línea."
+	case sunat.AuthErrorLockedUser:
+		return "El usuario SOL está bloqueado. Desbloquéelo desde SUNAT Operaciones en Línea antes de volver a intentar."
+	case sunat.AuthErrorInvalidScope:
+		return "Las credenciales de la API no tienen acceso al scope solicitado. Verifique --scope y los permisos del Client ID."
+	case sunat.AuthErrorServer:
+		return "SUNAT no pudo procesar la autenticación. Intente nuevamente en unos minutos."
+	default:
+		return "SUNAT rechazó la autenticación. Revise el detalle del error."
+	}
+}
+
+func signatureErrorHint(err error) string {
+	switch {
+	case errors.Is(err, firma.ErrNotSigned):
+		return "El comprobante no está firmado. Fírmelo con 'sunat comprobante firmar' o use 'procesar --firmar'."
+	case errors.Is(err, firma.ErrDigestMismatch):
+		return "El contenido del comprobante fue modificado después de firmarlo. Vuelva a firmar el XML original."
+	case errors.Is(err, firma.ErrInvalidSignatureValue):
+		return "La firma no corresponde al certificado incluido o fue alterada. Vuelva a firmar el comprobante."
+	case errors.Is(err, firma.ErrCertificateExpired):
+		return "El certificado digital está vencido. Renueve el certificado y vuelva a firmar el comprobante."
+	case errors.Is(err, firma.ErrCertificateNotYetValid):
+		return "El certificado digital aún no es válido. Verifique la fecha y hora del equipo."
+	case errors.Is(err, firma.ErrCertificateRUCMismatch):
+		return "El certificado digital no pertenece al RUC emisor del comprobante. Firme con el certificado de la empresa emisora."
+	case errors.Is(err, firma.ErrWrongPassword):
+		return "La contraseña del certificado digital es incorrecta. Verifique --cert-password o --cert-password-file."
+	case errors.Is(err, firma.ErrKeyMismatch), errors.Is(err, firma.ErrNoPrivateKey):
+		return "El archivo no contiene la clave privada del certificado. Indique el archivo de la clave con --cert-key."
+	case errors.Is(err, ErrNoCertificate):
+		return "Indique el certificado digital con --cert o 'cert' en el archivo de configuración."
+	case errors.Is(err, firma.ErrMalformedSignature), errors.Is(err, firma.ErrUnsupportedAlgorithm):
+		return "La firma del comprobante no tiene el formato esperado. Vuelva a firmarlo con 'sunat comprobante firmar'."
+	default:
+		return ""
+	}
+}
+
+func sendErrorHint(err error) string {
+	if errors.Is(err, sunat.ErrPayloadTooLarge) {
+		return "El comprobante comprimido excede el tamaño máximo de --max-payload-size. Divida la guía en varios comprobantes o aumente el límite."
+	}
+
+	if errors.Is(err, sunat.ErrInterruptedSend) {
+		return "Verifique en SUNAT si el comprobante fue recibido. Si no lo fue, ejecute el mismo comando con --force para enviarlo de nuevo."
+	}
+
+	var alreadySent *sunat.AlreadySentError
+	if !errors.As(err, &alreadySent) {
+		return ""
+	}
+
+	ticket := alreadySent.Record.Ticket
+	pollCommand := fmt.Sprintf("'%s %s'", ticketCommandPath(), ticket)
+	if alreadySent.Record.Status == sunat.SendStatusAccepted && !alreadySent.SameContent {
+		return fmt.Sprintf("SUNAT ya aceptó otro contenido con este número (ticket %s) y no se puede reemplazar. Emita la guía corregida con otro número; el CDR de la aceptada se obtiene con %s.", ticket, pollCommand)
+	}
+
+	if alreadySent.Record.Status == sunat.SendStatusAccepted {
+		return fmt.Sprintf("El comprobante ya fue aceptado por SUNAT (ticket %s). Obtenga el CDR con %s o use --force para enviarlo de nuevo.", ticket, pollCommand)
+	}
+
+	return fmt.Sprintf("El comprobante ya fue enviado y está pendiente de respuesta. Consulte su resultado con %s o use --force para enviarlo de nuevo.", pollCommand)
+}
+
+func ticketCommandPath() string {
+	if TicketCmd == nil {
+		return "sunat comprobante obtener"
+	}
+
+	return TicketCmd.CommandPath()
+}
+
+func apiErrorHint(apiErr *sunat.APIError) string {
+	switch {
+	case apiErr.IsUnauthorized():
+		return "SUNAT rechazó el token. Ejecute 'sunat token limpiar' y vuelva a intentar."
+	case apiErr.StatusCode >= 500:
+		return "SUNAT no pudo procesar la solicitud. Intente nuevamente en unos minutos."
+	default:
+		return ""
+	}
+}
+
+// ErrorDetails returns one line per detailed error reported by SUNAT in
+// err, if any
+func ErrorDetails(err error) []string {
+	var apiErr *sunat.APIError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+
+	details := make([]string, 0, len(apiErr.Errors))
+	for _, d := range apiErr.Errors {
+		details = append(details, fmt.Sprintf("[%s] %s", d.Code, d.Message))
+	}
+
+	return details
+}
+
+// PrintError prints err to stderr followed by the errors detailed by SUNAT
+// and a hint to solve it, if any
+func PrintError(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+	for _, d := range ErrorDetails(err) {
+		fmt.Fprintf(os.Stderr, "  - %s\n", d)
+	}
+
+	if hint := ErrorHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/haguirrear/sunatapi/pkg/secret"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/spf13/viper"
+)
+
+// The credentials are loaded only by the commands that need them, so the
+// others do not ask for the vault passphrase nor run the helper commands
+var vaultOnce sync.Once
+var vaultErr error
+
+var authSecretsOnce sync.Once
+var authSecretsErr error
+
+var certSecretsOnce sync.Once
+var certSecretsErr error
+
+// secretKeys are the configuration keys of a secret given directly, in a
+// file or by a helper command
+type secretKeys struct {
+	value, file, command string
+}
+
+var passwordKeys = secretKeys{"password", "passwordfile", "passwordcommand"}
+var clientSecretKeys = secretKeys{"clientsecret", "clientsecretfile", "clientsecretcommand"}
+var certPasswordKeys = secretKeys{"certpassword", "certpasswordfile", "certpasswordcommand"}
+
+// Flags of the secret keys
+var secretFlags = map[string]string{
+	"password":         "password",
+	"passwordfile":     "password-file",
+	"clientsecret":     "client-secret",
+	"clientsecretfile": "client-secret-file",
+	"certpassword":     "cert-password",
+	"certpasswordfile": "cert-password-file",
+}
+
+// Env variables of the secret keys, besides SUNAT_<KEY>
+var secretEnv = map[string][]string{
+	"passwordfile":        {"SUNAT_PASSWORD_FILE"},
+	"passwordcommand":     {"SUNAT_PASSWORD_COMMAND"},
+	"clientsecret":        {"SUNAT_CLIENT_SECRET", "SUNAT_CLIENTSECRET"},
+	"clientsecretfile":    {"SUNAT_CLIENT_SECRET_FILE"},
+	"clientsecretcommand": {"SUNAT_CLIENT_SECRET_COMMAND"},
+	"certpassword":        {"SUNAT_CERT_PASSWORD"},
+	"certpasswordfile":    {"SUNAT_CERT_PASSWORD_FILE"},
+	"certpasswordcommand": {"SUNAT_CERT_PASSWORD_COMMAND"},
+}
+
+// secretLayers returns the sources of a secret from the highest precedence
+// to the lowest: flags, env variables, credentials vault and config file.
+// Viper merges them, so e.g. --password would conflict with a passwordFile
+// in the config file.
+func secretLayers(keys secretKeys) []secret.Source {
+	layer := func(get func(key string) string) secret.Source {
+		return secret.Source{Value: get(keys.value), File: get(keys.file), Command: get(keys.command)}
+	}
+
+	return []secret.Source{
+		layer(flagValue),
+		layer(envValue),
+		layer(vaultValue),
+		// Only reached when none of the layers above is set, so the merged
+		// values come from the config file
+		layer(viper.GetString),
+	}
+}
+
+func flagValue(key string) string {
+	flag := RootCmd.PersistentFlags().Lookup(secretFlags[key])
+	if flag == nil || !flag.Changed {
+		return ""
+	}
+
+	return flag.Value.String()
+}
+
+func envValue(key string) string {
+	for _, name := range append([]string{"SUNAT_" + strings.ToUpper(key)}, secretEnv[key]...) {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func vaultValue(key string) string {
+	if vaultSettings == nil {
+		return ""
+	}
+
+	return vaultSettings.GetString(key)
+}
+
+// loadVault decrypts the credentials vault, if any, the first time it is
+// called and reloads ConfigData with its settings
+func loadVault() error {
+	vaultOnce.Do(func() {
+		if vaultErr = loadCredentialsVault(); vaultErr != nil {
+			return
+		}
+
+		if err := viper.Unmarshal(&ConfigData); err != nil {
+			vaultErr = fmt.Errorf("error reading configuration: %w", err)
+		}
+	})
+
+	return vaultErr
+}
+
+// ResolveAuthSecrets loads the credentials vault and replaces the Password
+// and ClientSecret in ConfigData with the content of their file or helper
+// command, when configured
+func ResolveAuthSecrets() error {
+	authSecretsOnce.Do(func() {
+		if authSecretsErr = loadVault(); authSecretsErr != nil {
+			return
+		}
+
+		password, err := secret.ResolveLayers(secretLayers(passwordKeys)...)
+		if err != nil {
+			authSecretsErr = fmt.Errorf("Password: %w", err)
+			return
+		}
+
+		clientSecret, err := secret.ResolveLayers(secretLayers(clientSecretKeys)...)
+		if err != nil {
+			authSecretsErr = fmt.Errorf("ClientSecret: %w", err)
+			return
+		}
+
+		ConfigData.Password = password
+		ConfigData.ClientSecret = clientSecret
+
+		// The grant type may come from the vault
+		grantType, err := sunat.ParseGrantType(ConfigData.GrantType)
+		if err != nil {
+			authSecretsErr = err
+			return
+		}
+
+		warnUnsetCredentials(grantType)
+	})
+
+	return authSecretsErr
+}
+
+// ResolveCertSecrets loads the credentials vault and replaces the
+// CertPassword in ConfigData with the content of its file or helper
+// command, when configured
+func ResolveCertSecrets() error {
+	certSecretsOnce.Do(func() {
+		if certSecretsErr = loadVault(); certSecretsErr != nil {
+			return
+		}
+
+		certPassword, err := secret.ResolveLayers(secretLayers(certPasswordKeys)...)
+		if err != nil {
+			certSecretsErr = fmt.Errorf("CertPassword: %w", err)
+			return
+		}
+
+		ConfigData.CertPassword = certPassword
+	})
+
+	return certSecretsErr
+}
+
+// warnUnsetCredentials lists the credentials needed to obtain a token that
+// are not configured
+func warnUnsetCredentials(grantType sunat.GrantType) {
+	var unset []string
+
+	// The Clave SOL is only needed for the password grant
+	if grantType == sunat.GrantTypePassword && ConfigData.User == "" {
+		unset = append(unset, "User")
+	}
+
+	if grantType == sunat.GrantTypePassword && ConfigData.Password == "" {
+		unset = append(unset, "Password")
+	}
+
+	if ConfigData.ClientID == "" {
+		unset = append(unset, "ClientID")
+	}
+
+	if ConfigData.ClientSecret == "" {
+		unset = append(unset, "ClientSecret")
+	}
+
+	if len(unset) > 0 {
+		fmt.Fprintf(os.Stderr, "error: required configurations not set\n")
+		for _, name := range unset {
+			fmt.Fprintf(os.Stderr, "- %s\n", name)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/haguirrear/sunatapi/pkg/secret"
+	"github.com/spf13/viper"
+)
+
+func TestSecretLayersFlagOverridesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "clave_sol")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// passwordFile in the config file
+	if err := viper.MergeConfigMap(map[string]any{"passwordfile": file}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := secret.ResolveLayers(secretLayers(passwordKeys)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "from-file" {
+		t.Fatalf("expected 'from-file', got '%s'", got)
+	}
+
+	flag := RootCmd.PersistentFlags().Lookup("password")
+	if err := flag.Value.Set("from-flag"); err != nil {
+		t.Fatal(err)
+	}
+	flag.Changed = true
+	t.Cleanup(func() {
+		flag.Value.Set("")
+		flag.Changed = false
+	})
+
+	got, err = secret.ResolveLayers(secretLayers(passwordKeys)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "from-flag" {
+		t.Fatalf("expected --password to override passwordFile, got '%s'", got)
+	}
+
+	t.Setenv("SUNAT_PASSWORD_COMMAND", "echo from-env")
+	got, err = secret.ResolveLayers(secretLayers(passwordKeys)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "from-flag" {
+		t.Fatalf("expected --password to override SUNAT_PASSWORD_COMMAND, got '%s'", got)
+	}
+}
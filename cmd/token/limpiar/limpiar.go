@@ -0,0 +1,37 @@
+package limpiar
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/haguirrear/sunatapi/cmd/token"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/spf13/cobra"
+)
+
+var LimpiarCmd = &cobra.Command{
+	Use:   "limpiar",
+	Short: "Elimina los tokens de acceso guardados en el cache",
+	Long: `Elimina los tokens de acceso guardados en el cache.
+La siguiente ejecución solicitará un nuevo token a SUNAT.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cacheDir, err := sunat.DefaultTokenCacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		removed, err := sunat.NewTokenCache(cacheDir).Clear()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Se eliminaron %d tokens del cache (%s)\n", removed, cacheDir)
+	},
+}
+
+func init() {
+	token.TokenCmd.AddCommand(LimpiarCmd)
+}
@@ -0,0 +1,158 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/haguirrear/sunatapi/cmd"
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/spf13/cobra"
+)
+
+var raw bool
+var metadataOnly bool
+var outputFormat string
+
+var TokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Obtiene e inspecciona el token de acceso a la API de SUNAT",
+	Long: `Obtiene un token de acceso usando las credenciales configuradas y muestra
+su información: emisor, vencimiento, RUC/usuario y scopes.
+
+Para usarlo en scripts:
+	curl -H "Authorization: Bearer $(sunat token --raw)" ...`,
+	Args: cobra.NoArgs,
+	Run: func(c *cobra.Command, args []string) {
+		if outputFormat != "text" && outputFormat != "json" {
+			fmt.Fprintf(os.Stderr, "error: formato de salida no soportado '%s', use 'text' o 'json'\n", outputFormat)
+			os.Exit(1)
+		}
+
+		s := cmd.NewSunat()
+		token, err := s.Tokens.Token(c.Context())
+		if err != nil {
+			cmd.PrintError(err)
+			os.Exit(1)
+		}
+
+		if raw {
+			fmt.Println(token.AccessToken)
+			return
+		}
+
+		info := newTokenInfo(token)
+		if metadataOnly {
+			info.AccessToken = ""
+		}
+
+		if outputFormat == "json" {
+			out, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Println(string(out))
+			return
+		}
+
+		printTokenInfo(info)
+	},
+}
+
+type tokenInfo struct {
+	AccessToken string             `json:"access_token,omitempty"`
+	TokenType   string             `json:"token_type,omitempty"`
+	ExpiresAt   *time.Time         `json:"expires_at,omitempty"`
+	ExpiresIn   *int64             `json:"expires_in,omitempty"`
+	Expired     bool               `json:"expired"`
+	Claims      *sunat.TokenClaims `json:"claims,omitempty"`
+	Scopes      []string           `json:"scopes,omitempty"`
+	ClaimsError string             `json:"claims_error,omitempty"`
+}
+
+func newTokenInfo(token sunat.Token) tokenInfo {
+	info := tokenInfo{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+	}
+
+	expiresAt := token.ExpiresAt
+
+	claims, err := sunat.ParseTokenClaims(token.AccessToken)
+	if err == nil {
+		info.Claims = &claims
+		info.Scopes = claims.Scopes()
+		if exp := claims.Expiration(); !exp.IsZero() {
+			expiresAt = exp
+		}
+	} else if !errors.Is(err, sunat.ErrNotJWT) {
+		info.ClaimsError = err.Error()
+	}
+
+	if !expiresAt.IsZero() {
+		remaining := int64(time.Until(expiresAt).Seconds())
+		info.ExpiresAt = &expiresAt
+		info.ExpiresIn = &remaining
+		info.Expired = remaining <= 0
+	}
+
+	return info
+}
+
+func printTokenInfo(info tokenInfo) {
+	if info.AccessToken != "" {
+		fmt.Printf("Token:        %s\n", info.AccessToken)
+	}
+
+	if info.TokenType != "" {
+		fmt.Printf("Tipo:         %s\n", info.TokenType)
+	}
+
+	if info.Claims != nil {
+		fmt.Printf("Emisor:       %s\n", info.Claims.Issuer)
+		if info.Claims.UserData.RUC != "" {
+			fmt.Printf("RUC:          %s\n", info.Claims.UserData.RUC)
+		}
+
+		if info.Claims.UserData.UserSOL != "" {
+			fmt.Printf("Usuario SOL:  %s\n", info.Claims.UserData.UserSOL)
+		}
+
+		if issued := info.Claims.IssuedAtTime(); !issued.IsZero() {
+			fmt.Printf("Emitido:      %s\n", issued.Local().Format(time.RFC3339))
+		}
+
+		if len(info.Scopes) > 0 {
+			fmt.Printf("Scopes:       %s\n", strings.Join(info.Scopes, ", "))
+		}
+	}
+
+	if info.ClaimsError != "" {
+		fmt.Printf("Claims:       no se pudieron leer (%s)\n", info.ClaimsError)
+	}
+
+	if info.ExpiresAt == nil {
+		fmt.Println("Vencimiento:  desconocido")
+		return
+	}
+
+	fmt.Printf("Vencimiento:  %s\n", info.ExpiresAt.Local().Format(time.RFC3339))
+	if info.Expired {
+		fmt.Println("Vigencia:     vencido")
+	} else {
+		fmt.Printf("Vigencia:     %s\n", (time.Duration(*info.ExpiresIn) * time.Second).String())
+	}
+}
+
+func init() {
+	cmd.RootCmd.AddCommand(TokenCmd)
+
+	TokenCmd.Flags().BoolVar(&raw, "raw", false, "Mostrar solo el token, para usarlo en scripts")
+	TokenCmd.Flags().BoolVar(&metadataOnly, "metadata", false, "Mostrar solo la información del token, sin el token")
+	TokenCmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Formato de salida: text o json")
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/haguirrear/sunatapi/pkg/vault"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// Encrypted credentials file searched in the current folder
+const DefaultVaultFile = ".sunatapi.vault"
+
+// Environment variable with the passphrase for unattended runs
+const VaultPassphraseEnv = "SUNAT_VAULT_PASSPHRASE"
+
+// The passphrase is asked only once per execution
+var vaultPassphrase string
+
+// Settings of the decrypted credentials vault, nil if there is none
+var vaultSettings *viper.Viper
+
+// CredentialsVaultPath returns the path of the encrypted credentials file,
+// empty if none is configured and the default one does not exist
+func CredentialsVaultPath() string {
+	if path := viper.GetString("credentialsfile"); path != "" {
+		return path
+	}
+
+	if _, err := os.Stat(DefaultVaultFile); err == nil {
+		return DefaultVaultFile
+	}
+
+	return ""
+}
+
+// VaultPassphrase returns the passphrase of the credentials vault, from
+// SUNAT_VAULT_PASSPHRASE or asking for it in the terminal
+func VaultPassphrase() (string, error) {
+	if vaultPassphrase != "" {
+		return vaultPassphrase, nil
+	}
+
+	if p := os.Getenv(VaultPassphraseEnv); p != "" {
+		vaultPassphrase = p
+		return p, nil
+	}
+
+	p, err := promptPassphrase("Contraseña del archivo de credenciales: ")
+	if err != nil {
+		return "", err
+	}
+
+	vaultPassphrase = p
+	return p, nil
+}
+
+// NewVaultPassphrase asks for a new passphrase twice to confirm it, unless
+// it is set in SUNAT_VAULT_PASSPHRASE
+func NewVaultPassphrase() (string, error) {
+	if p := os.Getenv(VaultPassphraseEnv); p != "" {
+		return p, nil
+	}
+
+	p, err := promptPassphrase("Nueva contraseña: ")
+	if err != nil {
+		return "", err
+	}
+
+	confirm, err := promptPassphrase("Repetir contraseña: ")
+	if err != nil {
+		return "", err
+	}
+
+	if p != confirm {
+		return "", errors.New("passphrases do not match")
+	}
+
+	return p, nil
+}
+
+func promptPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot ask for passphrase outside a terminal, set %s", VaultPassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("error reading passphrase: %w", err)
+	}
+
+	if len(p) == 0 {
+		return "", vault.ErrEmptyPassphrase
+	}
+
+	return string(p), nil
+}
+
+// loadCredentialsVault decrypts the credentials vault, if any, and merges its
+// settings into the configuration. Flags and env variables still take
+// precedence over it.
+func loadCredentialsVault() error {
+	path := CredentialsVaultPath()
+	if path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading credentials file: %w", err)
+	}
+
+	passphrase, err := VaultPassphrase()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := vault.Decrypt(content, passphrase)
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", path, err)
+	}
+
+	// Parsed separately so it does not depend on the format of the config file
+	credentials := viper.New()
+	credentials.SetConfigType("yaml")
+	if err := credentials.ReadConfig(bytes.NewReader(plaintext)); err != nil {
+		return fmt.Errorf("error reading decrypted credentials: %w", err)
+	}
+
+	if err := viper.MergeConfigMap(credentials.AllSettings()); err != nil {
+		return fmt.Errorf("error loading decrypted credentials: %w", err)
+	}
+	vaultSettings = credentials
+
+	GetLogger().Debugf("Using credentials file: %s", path)
+
+	return nil
+}
@@ -4,10 +4,25 @@ import (
 	_ "embed"
 
 	"github.com/haguirrear/sunatapi/cmd"
+	_ "github.com/haguirrear/sunatapi/cmd/certificado"
+	_ "github.com/haguirrear/sunatapi/cmd/certificado/convertir"
+	_ "github.com/haguirrear/sunatapi/cmd/certificado/info"
+	_ "github.com/haguirrear/sunatapi/cmd/certificado/verificar"
 	_ "github.com/haguirrear/sunatapi/cmd/comprobante"
 	_ "github.com/haguirrear/sunatapi/cmd/comprobante/consultar"
 	_ "github.com/haguirrear/sunatapi/cmd/comprobante/enviar"
+	_ "github.com/haguirrear/sunatapi/cmd/comprobante/firmar"
+	_ "github.com/haguirrear/sunatapi/cmd/comprobante/lote"
 	_ "github.com/haguirrear/sunatapi/cmd/comprobante/procesar"
+	_ "github.com/haguirrear/sunatapi/cmd/comprobante/validar"
+	_ "github.com/haguirrear/sunatapi/cmd/comprobante/verificarfirma"
+	_ "github.com/haguirrear/sunatapi/cmd/comprobante/vigilar"
+	_ "github.com/haguirrear/sunatapi/cmd/config"
+	_ "github.com/haguirrear/sunatapi/cmd/config/cifrar"
+	_ "github.com/haguirrear/sunatapi/cmd/config/descifrar"
+	_ "github.com/haguirrear/sunatapi/cmd/config/editar"
+	_ "github.com/haguirrear/sunatapi/cmd/token"
+	_ "github.com/haguirrear/sunatapi/cmd/token/limpiar"
 )
 
 //go:embed version
@@ -0,0 +1,77 @@
+// Package filelock provides advisory, inter-process file locks.
+package filelock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Longest wait between two attempts to lock a file held by another process
+const maxPollInterval = 100 * time.Millisecond
+
+// Lock represents an exclusive lock held over a file
+type Lock struct {
+	file *os.File
+}
+
+// Acquire creates (if needed) the file in path and waits until an exclusive
+// lock over it is obtained or ctx is done. The caller must call Release when
+// done.
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating lock folder: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file %s: %w", path, err)
+	}
+
+	// The lock is polled without blocking, so waiting for a lock held by a
+	// stuck process can be cancelled
+	interval := time.Millisecond
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("error locking file %s: %w", path, err)
+		}
+
+		if locked {
+			return &Lock{file: f}, nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			f.Close()
+			return nil, fmt.Errorf("error locking file %s: %w", path, ctx.Err())
+		case <-timer.C:
+		}
+
+		if interval *= 2; interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+}
+
+// Release frees the lock and closes the underlying file
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	errUnlock := unlockFile(l.file)
+	errClose := l.file.Close()
+	l.file = nil
+
+	if errUnlock != nil {
+		return fmt.Errorf("error unlocking file: %w", errUnlock)
+	}
+
+	return errClose
+}
@@ -0,0 +1,40 @@
+package filelock
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireWaitsUntilContextDone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "a.lock")
+
+	lock, err := Acquire(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := Acquire(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded while the lock is held, got %v", err)
+	}
+
+	// Released while the second one waits
+	time.AfterFunc(20*time.Millisecond, func() { lock.Release() })
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	second, err := Acquire(ctx, path)
+	if err != nil {
+		t.Fatalf("expected the lock after it was released, got %v", err)
+	}
+
+	if err := second.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+// Package secret resolves credentials that can be given directly, read from
+// a file or obtained from the output of an external helper command.
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Maximum time an external helper command can take to print the secret
+const commandTimeout = 30 * time.Second
+
+var ErrMultipleSources = errors.New("more than one source configured for the same secret")
+
+// Source describes where to obtain a secret from. At most one of its fields
+// should be set.
+type Source struct {
+	// The secret itself
+	Value string
+	// Path of a file whose content is the secret
+	File string
+	// Command whose standard output is the secret (e.g. "pass show sunat/clave-sol")
+	Command string
+}
+
+// IsSet reports whether any source was configured
+func (s Source) IsSet() bool {
+	return s.Value != "" || s.File != "" || s.Command != ""
+}
+
+// Resolve returns the secret from the configured source. Trailing newlines
+// are removed from files and command outputs.
+func Resolve(s Source) (string, error) {
+	count := 0
+	for _, v := range []string{s.Value, s.File, s.Command} {
+		if v != "" {
+			count++
+		}
+	}
+
+	if count > 1 {
+		return "", ErrMultipleSources
+	}
+
+	switch {
+	case s.File != "":
+		return readFile(s.File)
+	case s.Command != "":
+		return runCommand(s.Command)
+	default:
+		return s.Value, nil
+	}
+}
+
+// ResolveLayers returns the secret from the first layer with a source set,
+// given from the highest precedence to the lowest (e.g. flags, environment
+// variables and config file). A higher layer overrides the sources of the
+// lower ones, only more than one source in the same layer is an error.
+func ResolveLayers(layers ...Source) (string, error) {
+	for _, s := range layers {
+		if s.IsSet() {
+			return Resolve(s)
+		}
+	}
+
+	return "", nil
+}
+
+func readFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file: %w", err)
+	}
+
+	return trimNewline(string(content)), nil
+}
+
+func runCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	// Allows helpers like pass or gpg to ask for their own passphrase
+	c.Stdin = os.Stdin
+
+	if err := c.Run(); err != nil {
+		detail := strings.TrimSpace(stderr.String())
+		if detail != "" {
+			return "", fmt.Errorf("error running secret command: %w: %s", err, detail)
+		}
+
+		return "", fmt.Errorf("error running secret command: %w", err)
+	}
+
+	return trimNewline(stdout.String()), nil
+}
+
+func trimNewline(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
@@ -0,0 +1,84 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		source   Source
+		expected string
+	}{
+		{"value", Source{Value: "plain"}, "plain"},
+		{"file", Source{File: file}, "from-file"},
+		{"empty", Source{}, ""},
+	}
+
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			name     string
+			source   Source
+			expected string
+		}{"command", Source{Command: "echo from-command"}, "from-command"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.expected {
+				t.Fatalf("expected '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := Resolve(Source{Value: "plain", File: file}); err != ErrMultipleSources {
+		t.Fatalf("expected ErrMultipleSources, got %v", err)
+	}
+}
+
+func TestResolveLayers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		layers   []Source
+		expected string
+	}{
+		{"flag overrides file", []Source{{Value: "from-flag"}, {}, {File: file}}, "from-flag"},
+		{"file from a lower layer", []Source{{}, {}, {File: file}}, "from-file"},
+		{"none set", []Source{{}, {}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveLayers(tt.layers...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.expected {
+				t.Fatalf("expected '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := ResolveLayers(Source{Value: "plain", File: file}, Source{Command: "echo"}); err != ErrMultipleSources {
+		t.Fatalf("expected ErrMultipleSources, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package sunat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when the SUNAT API answers with an HTTP error.
+// Use errors.As to inspect it:
+//
+//	var apiErr *sunat.APIError
+//	if errors.As(err, &apiErr) && apiErr.HasCode("1033") { ... }
+type APIError struct {
+	StatusCode int
+	Status     string
+	// SUNAT error code and message
+	Code    string
+	Message string
+	// Detailed errors, e.g. one per invalid field. They are not included in
+	// Error()
+	Errors []APIErrorDetail
+	// Raw response body
+	Body string
+}
+
+type APIErrorDetail struct {
+	Code    string `json:"cod"`
+	Message string `json:"msg"`
+}
+
+type apiErrorBody struct {
+	Code    json.RawMessage  `json:"cod"`
+	Message string           `json:"msg"`
+	Errors  []apiErrorDetail `json:"errors"`
+}
+
+type apiErrorDetail struct {
+	Code    json.RawMessage `json:"cod"`
+	Message string          `json:"msg"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("SUNAT API error: %s | %s", e.Status, e.Body)
+	}
+
+	return fmt.Sprintf("SUNAT API error: %s | %s: %s", e.Status, e.Code, e.Message)
+}
+
+// HasCode reports whether code is the main SUNAT error code or the code of
+// any of the detailed errors
+func (e *APIError) HasCode(code string) bool {
+	if e.Code == code {
+		return true
+	}
+
+	for _, d := range e.Errors {
+		if d.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsUnauthorized reports whether the token was rejected (missing, invalid
+// or expired)
+func (e *APIError) IsUnauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+// codeString reads codes that SUNAT sends either as strings or numbers
+func codeString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	return strings.Trim(string(raw), `"`)
+}
+
+func newAPIError(res *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Body:       string(body),
+	}
+
+	var parsed apiErrorBody
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return apiErr
+	}
+
+	apiErr.Code = codeString(parsed.Code)
+	apiErr.Message = parsed.Message
+	for _, d := range parsed.Errors {
+		apiErr.Errors = append(apiErr.Errors, APIErrorDetail{Code: codeString(d.Code), Message: d.Message})
+	}
+
+	return apiErr
+}
@@ -0,0 +1,39 @@
+package sunat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendReceiptAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"cod":"422","msg":"Validation failed","errors":[{"cod":1033,"msg":"El comprobante fue registrado previamente"}]}`)
+	}))
+	defer server.Close()
+
+	s := Sunat{Tokens: NewStaticTokenSource("token")}
+	_, err := s.SendReceipt(context.Background(), server.URL, SendReceiptParams{ReceiptFilePath: "20123456789-09-T001-1.xml"})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Code != "422" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+
+	if !apiErr.HasCode("1033") {
+		t.Fatalf("expected nested code 1033, got %+v", apiErr.Errors)
+	}
+
+	if apiErr.HasCode("2000") {
+		t.Fatal("unexpected code 2000")
+	}
+}
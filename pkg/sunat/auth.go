@@ -11,61 +11,143 @@ import (
 	"time"
 )
 
+type GrantType string
+
+const (
+	// Authenticates with Clave SOL, used by the GRE API
+	GrantTypePassword GrantType = "password"
+	// Authenticates only with the client credentials, used by APIs like
+	// consulta de validez de CPE or SIRE
+	GrantTypeClientCredentials GrantType = "client_credentials"
+)
+
+// Scope of the GRE API (https://api-cpe.sunat.gob.pe)
+const DefaultScope = "https://api-cpe.sunat.gob.pe"
+
 type AuthParams struct {
 	ClientID     string
 	ClientSecret string
 	Username     string
 	Password     string
+	// Defaults to DefaultScope
+	Scope string
+	// Defaults to GrantTypePassword
+	GrantType GrantType
+}
+
+func (p AuthParams) scope() string {
+	if p.Scope == "" {
+		return DefaultScope
+	}
+
+	return p.Scope
+}
+
+func (p AuthParams) grantType() GrantType {
+	if p.GrantType == "" {
+		return GrantTypePassword
+	}
+
+	return p.GrantType
+}
+
+// ParseGrantType validates the name of a supported grant type
+func ParseGrantType(name string) (GrantType, error) {
+	switch g := GrantType(name); g {
+	case "":
+		return GrantTypePassword, nil
+	case GrantTypePassword, GrantTypeClientCredentials:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unsupported grant type '%s', use '%s' or '%s'", name, GrantTypePassword, GrantTypeClientCredentials)
+	}
 }
 
 type AuthResponseBody struct {
 	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Token is an OAuth access token together with its expiration time
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
 }
 
-const defaultTimeout = 10 * time.Second
+// IsValid reports whether the token can still be used for at least the
+// duration of margin. Tokens without a known expiration are never valid.
+func (t Token) IsValid(margin time.Duration) bool {
+	if t.AccessToken == "" || t.ExpiresAt.IsZero() {
+		return false
+	}
+
+	return time.Now().Add(margin).Before(t.ExpiresAt)
+}
 
-func (s Sunat) GetToken(baseURL string, params AuthParams) (token string, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+func (s Sunat) GetToken(ctx context.Context, baseURL string, params AuthParams) (token Token, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
 	defer cancel()
 
-	authURL := fmt.Sprintf("%s/v1/clientessol/%s/oauth2/token/", baseURL, params.ClientID)
 	form := url.Values{}
-	form.Set("scope", "https://api-cpe.sunat.gob.pe")
-	form.Set("grant_type", "password")
+	form.Set("scope", params.scope())
+	form.Set("grant_type", string(params.grantType()))
 	form.Set("client_id", params.ClientID)
 	form.Set("client_secret", params.ClientSecret)
-	form.Set("username", params.Username)
-	form.Set("password", params.Password)
+
+	var authURL string
+	switch params.grantType() {
+	case GrantTypePassword:
+		authURL = fmt.Sprintf("%s/v1/clientessol/%s/oauth2/token/", baseURL, params.ClientID)
+		form.Set("username", params.Username)
+		form.Set("password", params.Password)
+	case GrantTypeClientCredentials:
+		authURL = fmt.Sprintf("%s/v1/clientesextranet/%s/oauth2/token/", baseURL, params.ClientID)
+	default:
+		return Token{}, fmt.Errorf("unsupported grant type '%s'", params.GrantType)
+	}
 
 	encoded := strings.NewReader(form.Encode())
 	request, err := http.NewRequestWithContext(ctx, http.MethodPost, authURL, encoded)
 	if err != nil {
-		return "", fmt.Errorf("error building auth request: %w", err)
+		return Token{}, fmt.Errorf("error building auth request: %w", err)
 	}
 
 	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	// res, err := client.Do(request)
-	res, err := s.doRequest(client, request)
+	requestedAt := time.Now()
+	res, err := s.doRequest(request, authEndpoint)
 	if err != nil {
-		return "", fmt.Errorf("error in auth response: %w", err)
+		return Token{}, fmt.Errorf("error in auth response: %w", err)
 	}
 
 	body, err := io.ReadAll(res.Body)
 	defer res.Body.Close()
 
 	if err != nil {
-		return "", fmt.Errorf("error reading body of auth request with response %s: %w", res.Status, err)
+		return Token{}, fmt.Errorf("error reading body of auth request with response %s: %w", res.Status, err)
 	}
 
 	if res.StatusCode >= 400 {
-		return "", fmt.Errorf("error authorizing with SUNAT: %s | %s", res.Status, string(body))
+		return Token{}, newAuthError(res, body)
 	}
 
 	var parsed AuthResponseBody
 	if err = json.Unmarshal(body, &parsed); err != nil {
-		return "", fmt.Errorf("error deserializing auth response body into json: %w", err)
+		return Token{}, fmt.Errorf("error deserializing auth response body into json: %w", err)
+	}
+
+	token = Token{
+		AccessToken: parsed.AccessToken,
+		TokenType:   parsed.TokenType,
+	}
+
+	// The expiration is measured from the moment the request was sent, so
+	// the network latency only makes the token expire earlier, never later
+	if parsed.ExpiresIn > 0 {
+		token.ExpiresAt = requestedAt.Add(time.Duration(parsed.ExpiresIn) * time.Second)
 	}
 
-	return parsed.AccessToken, nil
+	return token, nil
 }
@@ -0,0 +1,75 @@
+package sunat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetTokenClientCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/clientesextranet/client/oauth2/token/" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		if r.PostForm.Get("grant_type") != "client_credentials" {
+			t.Errorf("expected client_credentials grant, got '%s'", r.PostForm.Get("grant_type"))
+		}
+
+		if r.PostForm.Get("scope") != "https://api.sunat.gob.pe/v1/contribuyente/contribuyentes" {
+			t.Errorf("unexpected scope '%s'", r.PostForm.Get("scope"))
+		}
+
+		if r.PostForm.Has("username") || r.PostForm.Has("password") {
+			t.Error("client_credentials grant must not send username or password")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"token","token_type":"JWT","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	s := Sunat{}
+	token, err := s.GetToken(context.Background(), server.URL, AuthParams{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scope:        "https://api.sunat.gob.pe/v1/contribuyente/contribuyentes",
+		GrantType:    GrantTypeClientCredentials,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "token" || token.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected token %+v", token)
+	}
+}
+
+func TestTokenCacheKeyByScope(t *testing.T) {
+	production := "https://api-seguridad.sunat.gob.pe"
+	gre := AuthParams{ClientID: "client", Username: "user"}
+	other := AuthParams{ClientID: "client", Username: "user", Scope: "https://api.sunat.gob.pe"}
+
+	if TokenCacheKey(production, gre) == TokenCacheKey(production, other) {
+		t.Fatal("expected different cache keys for different scopes")
+	}
+
+	explicit := AuthParams{ClientID: "client", Username: "user", Scope: DefaultScope, GrantType: GrantTypePassword}
+	if TokenCacheKey(production, gre) != TokenCacheKey(production, explicit) {
+		t.Fatal("expected default scope and grant type to share the cache key")
+	}
+
+	if TokenCacheKey(production, gre) == TokenCacheKey("https://gre-test.nubefact.com", gre) {
+		t.Fatal("expected different cache keys for different auth base URLs")
+	}
+
+	if TokenCacheKey(production, gre) != TokenCacheKey(production+"/", gre) {
+		t.Fatal("expected a trailing slash to share the cache key")
+	}
+}
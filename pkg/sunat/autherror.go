@@ -0,0 +1,158 @@
+package sunat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AuthErrorKind classifies why SUNAT rejected an authentication request
+type AuthErrorKind int
+
+const (
+	AuthErrorUnknown AuthErrorKind = iota
+	// Wrong user or Clave SOL
+	AuthErrorInvalidCredentials
+	// Unknown client_id or wrong client_secret
+	AuthErrorInvalidClient
+	// The client exists but is disabled or was revoked
+	AuthErrorDisabledClient
+	// The user SOL is locked, usually after many failed attempts
+	AuthErrorLockedUser
+	// The client is not allowed to request the scope
+	AuthErrorInvalidScope
+	// SUNAT failed to process the request
+	AuthErrorServer
+)
+
+func (k AuthErrorKind) String() string {
+	switch k {
+	case AuthErrorInvalidCredentials:
+		return "invalid_credentials"
+	case AuthErrorInvalidClient:
+		return "invalid_client"
+	case AuthErrorDisabledClient:
+		return "disabled_client"
+	case AuthErrorLockedUser:
+		return "locked_user"
+	case AuthErrorInvalidScope:
+		return "invalid_scope"
+	case AuthErrorServer:
+		return "server_error"
+	default:
+		return "unknown"
+	}
+}
+
+// AuthError is returned by GetToken when SUNAT rejects the authentication
+type AuthError struct {
+	StatusCode int
+	Status     string
+	// OAuth error code (e.g. invalid_client)
+	Code        string
+	Description string
+	Kind        AuthErrorKind
+	// Raw response body
+	Body string
+}
+
+func (e *AuthError) Error() string {
+	if e.Code == "" && e.Description == "" {
+		return fmt.Sprintf("error authorizing with SUNAT: %s | %s", e.Status, e.Body)
+	}
+
+	return fmt.Sprintf("error authorizing with SUNAT: %s | %s: %s", e.Status, e.Code, e.Description)
+}
+
+type authErrorBody struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	// Some SUNAT endpoints answer with their own error format
+	Cod string `json:"cod"`
+	Msg string `json:"msg"`
+}
+
+func newAuthError(res *http.Response, body []byte) *AuthError {
+	authErr := &AuthError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Body:       string(body),
+	}
+
+	var parsed authErrorBody
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		authErr.Code = parsed.Error
+		authErr.Description = parsed.ErrorDescription
+
+		if authErr.Code == "" {
+			authErr.Code = parsed.Cod
+		}
+
+		if authErr.Description == "" {
+			authErr.Description = parsed.Msg
+		}
+	}
+
+	authErr.Kind = classifyAuthError(authErr.StatusCode, authErr.Code, authErr.Description)
+
+	return authErr
+}
+
+// classifyAuthError picks the kind from the OAuth error code, the
+// description only refines it (e.g. a disabled client is also an
+// invalid_client). The description alone is used when SUNAT answers
+// without a known code.
+func classifyAuthError(statusCode int, code, description string) AuthErrorKind {
+	desc := strings.ToLower(description)
+	containsAny := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(desc, w) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	locked := func() bool { return containsAny("bloquead", "locked") }
+	disabled := func() bool {
+		return containsAny("inactiv", "deshabilitad", "disabled", "de baja", "suspendid", "revocad", "revoked")
+	}
+
+	if statusCode >= 500 {
+		return AuthErrorServer
+	}
+
+	switch code {
+	case "invalid_client", "unauthorized_client":
+		if disabled() {
+			return AuthErrorDisabledClient
+		}
+		return AuthErrorInvalidClient
+	case "invalid_grant", "access_denied":
+		if locked() {
+			return AuthErrorLockedUser
+		}
+		return AuthErrorInvalidCredentials
+	case "invalid_scope":
+		return AuthErrorInvalidScope
+	}
+
+	// The user words are checked before the client ones, messages about the
+	// Clave SOL may also mention the client
+	switch {
+	case locked():
+		return AuthErrorLockedUser
+	case disabled():
+		return AuthErrorDisabledClient
+	case containsAny("scope"):
+		return AuthErrorInvalidScope
+	case containsAny("usuario", "contraseña", "contrasena", "clave", "password", "credencial", "autentica"):
+		return AuthErrorInvalidCredentials
+	case containsAny("client", "cliente"):
+		return AuthErrorInvalidClient
+	default:
+		return AuthErrorUnknown
+	}
+}
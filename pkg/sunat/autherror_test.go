@@ -0,0 +1,85 @@
+package sunat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetTokenAuthError(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		expected AuthErrorKind
+	}{
+		{400, `{"error":"invalid_grant","error_description":"Usuario o contraseña incorrectos"}`, AuthErrorInvalidCredentials},
+		{401, `{"error":"invalid_client","error_description":"El cliente no existe"}`, AuthErrorInvalidClient},
+		{400, `{"error":"invalid_client","error_description":"Cliente inactivo"}`, AuthErrorDisabledClient},
+		{400, `{"error":"access_denied","error_description":"Usuario bloqueado"}`, AuthErrorLockedUser},
+		{400, `{"error":"invalid_scope","error_description":"scope no permitido"}`, AuthErrorInvalidScope},
+		{503, `Service Unavailable`, AuthErrorServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected.String(), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			s := Sunat{}
+			_, err := s.GetToken(context.Background(), server.URL, AuthParams{ClientID: "client"})
+
+			var authErr *AuthError
+			if !errors.As(err, &authErr) {
+				t.Fatalf("expected AuthError, got %v", err)
+			}
+
+			if authErr.Kind != tt.expected {
+				t.Fatalf("expected kind %s, got %s", tt.expected, authErr.Kind)
+			}
+
+			if authErr.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, authErr.StatusCode)
+			}
+		})
+	}
+}
+
+func TestClassifyAuthErrorFixtures(t *testing.T) {
+	tests := []struct {
+		file     string
+		status   int
+		expected AuthErrorKind
+	}{
+		// The description mentions the client but the code says the Clave
+		// SOL is wrong
+		{"invalid_grant_for_client.json", 400, AuthErrorInvalidCredentials},
+		{"invalid_client.json", 401, AuthErrorInvalidClient},
+		{"disabled_client.json", 401, AuthErrorDisabledClient},
+		{"locked_user.json", 400, AuthErrorLockedUser},
+		// Without an OAuth code the description is used
+		{"cod_msg_credentials.json", 401, AuthErrorInvalidCredentials},
+		{"server_error.html", 503, AuthErrorServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", "autherror", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status)}
+			if kind := newAuthError(res, body).Kind; kind != tt.expected {
+				t.Fatalf("expected kind %s, got %s", tt.expected, kind)
+			}
+		})
+	}
+}
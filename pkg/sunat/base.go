@@ -1,7 +1,63 @@
 package sunat
 
-import "github.com/haguirrear/sunatapi/pkg/logger"
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/haguirrear/sunatapi/pkg/logger"
+)
 
 type Sunat struct {
 	Logger *logger.Logger
+	// Tokens provides the access token for the requests that need one
+	Tokens TokenSource
+	// Retry defines how failed requests are retried, by default they are not
+	Retry RetryPolicy
+	// Limiter throttles the requests sent to SUNAT, nil means no limit.
+	// It should be shared between all the clients of the process.
+	Limiter *RateLimiter
+	// HTTPClient sends the requests, http.DefaultClient settings are used if
+	// nil. To use a custom RoundTripper set &http.Client{Transport: rt}.
+	HTTPClient *http.Client
+	// Timeout of each operation, retries included. Defaults to DefaultTimeout
+	Timeout time.Duration
+	// HAR records every exchange with SUNAT when set
+	HAR *HARRecorder
+	// Redactor masks secrets in logs and HAR files, DefaultRedactor if nil
+	Redactor *Redactor
+	// Middlewares wrap every request sent to SUNAT, retries included
+	Middlewares []Middleware
+	// SkipSignatureCheck sends receipts without verifying their signature
+	// first, see firma.Verify
+	SkipSignatureCheck bool
+	// SendLog records the sent receipts, so an accepted receipt or one
+	// waiting for its result is not sent twice. Not used if nil.
+	SendLog *SendLog
+	// MaxPayloadSize is the largest send receipt request body,
+	// DefaultMaxPayloadSize if 0 and no limit if negative
+	MaxPayloadSize int64
+	// ForceSend sends the receipts even if SendLog says they were already
+	// sent
+	ForceSend bool
+}
+
+func (s Sunat) maxPayloadSize() int64 {
+	if s.MaxPayloadSize == 0 {
+		return DefaultMaxPayloadSize
+	}
+
+	return s.MaxPayloadSize
+}
+
+var discardLogger = logger.NewLogger(io.Discard, logger.ErrorLevel)
+
+// log returns the configured logger or one that discards everything
+// when the client was built without it
+func (s Sunat) log() *logger.Logger {
+	if s.Logger == nil {
+		return discardLogger
+	}
+
+	return s.Logger
 }
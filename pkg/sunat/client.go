@@ -3,66 +3,159 @@ package sunat
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/haguirrear/sunatapi/pkg/logger"
-	// loghttp "github.com/motemen/go-loghttp"
 )
 
-var client = &http.Client{
-	// Transport: &loghttp.Transport{},
+// LoggingMiddleware logs every request and response: the URL and status
+// at debug level, and the headers and bodies at trace level. Secrets are
+// masked with redactor.
+func LoggingMiddleware(log *logger.Logger, redactor *Redactor) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			log.Debugf("-> Request %s", redactor.URL(req.URL))
+			for k, v := range req.Header {
+				for _, vv := range v {
+					log.Tracef("Header '%s': '%s'", k, redactor.Header(k, vv))
+				}
+			}
+
+			// Reading the body again is only worth it if it is logged, the
+			// send receipt body is streamed
+			if log.Level <= logger.TraceLevel && req.Body != nil && req.Body != http.NoBody {
+				logReqBody(log, redactor, req)
+			}
+
+			res, err := next(req)
+
+			if err != nil {
+				return res, err
+			}
+
+			log.Debugf("<- Response %s", res.Status)
+
+			if res.Body != nil && res.Body != http.NoBody {
+				logResBody(log, redactor, res)
+			}
+
+			return res, err
+		}
+	}
 }
 
-func (s Sunat) doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
-	s.Logger.Debugf("-> Request %s", req.URL.String())
-	for k, v := range req.Header {
-		for _, vv := range v {
-			s.Logger.Tracef("Header '%s': '%s'", k, vv)
-		}
+// doAuthorizedRequest adds the token obtained from s.Tokens to the request.
+// If SUNAT rejects it with 401, the token is refreshed and the request
+// is sent once more.
+func (s Sunat) doAuthorizedRequest(req *http.Request, e endpoint) (*http.Response, error) {
+	if s.Tokens == nil {
+		return nil, ErrNoTokenSource
 	}
 
-	if req.Body != nil {
-		logReqBody(s.Logger, req)
+	token, err := s.Tokens.Token(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("error obtaining token: %w", err)
 	}
 
-	res, err := client.Do(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
 
-	if err != nil {
+	res, err := s.doRequest(req, e)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
 		return res, err
 	}
 
-	s.Logger.Debugf("<- Response %s", res.Status)
+	if req.Body != nil && req.GetBody == nil {
+		// The body was already consumed and cannot be sent again
+		return res, nil
+	}
+
+	s.log().Debug("Token rejected by SUNAT, obtaining a new one")
+	token, err = s.Tokens.Refresh(req.Context())
+	if errors.Is(err, ErrTokenNotRefreshable) {
+		return res, nil
+	}
+
+	if err != nil {
+		res.Body.Close()
+		return nil, fmt.Errorf("error refreshing token: %w", err)
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return res, nil
+		}
+	}
 
-	// for k, v := range res.Header {
-	// 	for _, vv := range v {
-	// 		s.Logger.Debugf("Header '%s': '%s'", k, vv)
-	//
-	// 	}
-	// }
+	res.Body.Close()
+	retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
 
-	if res.Body != nil && res.Body != http.NoBody {
-		logResBody(s.Logger, res)
+	return s.doRequest(retry, e)
+}
+
+func logReqBody(logger *logger.Logger, redactor *Redactor, req *http.Request) {
+	bodyBytes := readReqBody(req)
+	if bodyBytes == nil {
+		return
 	}
 
-	return res, err
+	bodyBytes = redactor.Body(req.Header.Get("Content-Type"), bodyBytes)
+	logger.Tracef("Body: %s", string(bodyBytes))
 }
 
-func logReqBody(logger *logger.Logger, req *http.Request) {
+// Request bodies longer than this are not copied to the logs nor the HAR
+// file, so a large receipt is still streamed instead of held in memory
+const maxRecordedBodySize = 1 << 20
+
+// readReqBody returns a copy of the request body, nil if it has none. A
+// body that cannot be read again or longer than maxRecordedBodySize is
+// replaced by a placeholder.
+func readReqBody(req *http.Request) []byte {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+
+	if req.GetBody == nil || req.ContentLength < 0 {
+		return []byte("[streamed body not recorded]")
+	}
+
+	if req.ContentLength > maxRecordedBodySize {
+		return []byte(fmt.Sprintf("[streamed body of %d bytes not recorded]", req.ContentLength))
+	}
 
 	b, err := req.GetBody()
 	if err != nil {
-		return
+		return nil
 	}
+	defer b.Close()
+
 	bodyBytes, err := io.ReadAll(b)
 	if err != nil {
-		return
+		return nil
 	}
-	logger.Tracef("Body: %s", string(bodyBytes))
+
+	return bodyBytes
+}
+
+// peekResBody reads the response body and replaces it with a copy, so it
+// can still be read by the caller
+func peekResBody(res *http.Response) []byte {
+	bodyBytes, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil
+	}
+
+	return bodyBytes
 }
 
-func logResBody(logger *logger.Logger, res *http.Response) {
+func logResBody(logger *logger.Logger, redactor *Redactor, res *http.Response) {
 	var buf bytes.Buffer
 	b := res.Body
 	if _, err := buf.ReadFrom(b); err != nil {
@@ -79,6 +172,8 @@ func logResBody(logger *logger.Logger, res *http.Response) {
 		return
 	}
 
+	bodyBytes = redactor.Body(res.Header.Get("Content-Type"), bodyBytes)
+
 	isJson := strings.Contains(res.Header.Get("Content-Type"), "application/json")
 	if isJson {
 		bodyJson := prettyPrintJson(string(bodyBytes))
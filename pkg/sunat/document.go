@@ -0,0 +1,247 @@
+package sunat
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidDocumentID  = errors.New("invalid document id")
+	ErrDocumentIDMismatch = errors.New("file name does not match the xml content")
+)
+
+var (
+	rucRegex            = regexp.MustCompile(`^(10|15|16|17|20)[0-9]{9}$`)
+	documentTypeRegex   = regexp.MustCompile(`^[0-9]{2}$`)
+	documentSeriesRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]{3}$`)
+	documentNumberRegex = regexp.MustCompile(`^[0-9]{1,8}$`)
+)
+
+// Document types that are inferred from the root element of the XML when
+// it has no type code
+var rootDocumentTypes = map[string]string{
+	"Invoice":        "01",
+	"CreditNote":     "07",
+	"DebitNote":      "08",
+	"DespatchAdvice": "09",
+}
+
+// DocumentID identifies an electronic document. SUNAT requires the file
+// name to be RUC-TIPO-SERIE-CORRELATIVO, e.g. 20123456789-09-T001-1
+type DocumentID struct {
+	// RUC of the issuer
+	RUC string
+	// Tipo de comprobante (catálogo 01), e.g. 09 for guía de remisión remitente
+	Type   string
+	Series string
+	Number string
+}
+
+// ParseDocumentID parses and validates a file name like
+// 20123456789-09-T001-1.xml. The directory and the .xml or .zip extension
+// are ignored.
+func ParseDocumentID(name string) (DocumentID, error) {
+	base := filepath.Base(name)
+	switch ext := filepath.Ext(base); strings.ToLower(ext) {
+	case ".xml", ".zip":
+		base = strings.TrimSuffix(base, ext)
+	}
+
+	parts := strings.Split(base, "-")
+	if len(parts) != 4 {
+		return DocumentID{}, fmt.Errorf("%w '%s': expected RUC-TIPO-SERIE-CORRELATIVO", ErrInvalidDocumentID, base)
+	}
+
+	id := DocumentID{
+		RUC:    parts[0],
+		Type:   parts[1],
+		Series: parts[2],
+		Number: parts[3],
+	}
+
+	if err := id.Validate(); err != nil {
+		return DocumentID{}, err
+	}
+
+	return id, nil
+}
+
+// Validate checks every part of the id against SUNAT's naming rules
+func (id DocumentID) Validate() error {
+	if !ValidRUC(id.RUC) {
+		return fmt.Errorf("%w '%s': invalid RUC '%s'", ErrInvalidDocumentID, id, id.RUC)
+	}
+
+	if !documentTypeRegex.MatchString(id.Type) {
+		return fmt.Errorf("%w '%s': invalid document type '%s', expected 2 digits", ErrInvalidDocumentID, id, id.Type)
+	}
+
+	if !documentSeriesRegex.MatchString(id.Series) {
+		return fmt.Errorf("%w '%s': invalid series '%s', expected 4 uppercase alphanumeric characters starting with a letter", ErrInvalidDocumentID, id, id.Series)
+	}
+
+	if !documentNumberRegex.MatchString(id.Number) || strings.Trim(id.Number, "0") == "" {
+		return fmt.Errorf("%w '%s': invalid number '%s', expected between 1 and 8 digits", ErrInvalidDocumentID, id, id.Number)
+	}
+
+	return nil
+}
+
+func (id DocumentID) String() string {
+	return fmt.Sprintf("%s-%s-%s-%s", id.RUC, id.Type, id.Series, id.Number)
+}
+
+// XMLFileName returns the file name SUNAT expects for the document
+func (id DocumentID) XMLFileName() string {
+	return id.String() + ".xml"
+}
+
+// ZipFileName returns the name SUNAT expects for the zip file sent
+func (id DocumentID) ZipFileName() string {
+	return id.String() + ".zip"
+}
+
+// ValidRUC reports whether ruc has 11 digits and a valid prefix (10, 15,
+// 16, 17 or 20). The check digit is not verified, as the RUCs used in
+// SUNAT's test environment do not always have a valid one.
+func ValidRUC(ruc string) bool {
+	return rucRegex.MatchString(ruc)
+}
+
+// DocumentIDFromXML reads the id of the document from its XML content: the
+// series and number from cbc:ID, the type from the type code (or the root
+// element) and the RUC from the supplier party. RUC is empty if the XML
+// does not include it.
+func DocumentIDFromXML(r io.Reader) (DocumentID, error) {
+	decoder := xml.NewDecoder(r)
+
+	var id DocumentID
+	var path []string
+	var docID string
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return DocumentID{}, fmt.Errorf("error reading xml: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			if len(path) == 1 {
+				id.Type = rootDocumentTypes[t.Name.Local]
+			}
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" || len(path) < 2 {
+				continue
+			}
+
+			switch {
+			case len(path) == 2 && path[1] == "ID":
+				docID = value
+			case len(path) == 2 && strings.HasSuffix(path[1], "TypeCode"):
+				id.Type = value
+			case id.RUC == "" && isSupplierRUC(path[1:]):
+				id.RUC = value
+			}
+		}
+	}
+
+	if docID == "" {
+		return DocumentID{}, fmt.Errorf("%w: cbc:ID not found in xml", ErrInvalidDocumentID)
+	}
+
+	series, number, ok := strings.Cut(docID, "-")
+	if !ok {
+		return DocumentID{}, fmt.Errorf("%w: cbc:ID '%s' is not SERIE-CORRELATIVO", ErrInvalidDocumentID, docID)
+	}
+
+	id.Series = series
+	id.Number = number
+
+	return id, nil
+}
+
+// isSupplierRUC reports whether path (without the root element) points to
+// the identifier of the issuer, either in UBL 2.1
+// (cac:DespatchSupplierParty/cac:Party/cac:PartyIdentification/cbc:ID) or
+// in the older cac:DespatchSupplierParty/cbc:CustomerAssignedAccountID
+func isSupplierRUC(path []string) bool {
+	if len(path) == 0 || !strings.HasSuffix(path[0], "SupplierParty") {
+		return false
+	}
+
+	rest := strings.Join(path[1:], "/")
+
+	return rest == "Party/PartyIdentification/ID" || rest == "CustomerAssignedAccountID"
+}
+
+// ReceiptDocumentID parses the id of the document from the file name and
+// checks that it matches the content of the XML
+func ReceiptDocumentID(receiptPath string, xmlContent io.Reader) (DocumentID, error) {
+	id, err := ParseDocumentID(receiptPath)
+	if err != nil {
+		return DocumentID{}, err
+	}
+
+	xmlID, err := DocumentIDFromXML(xmlContent)
+	if err != nil {
+		return DocumentID{}, fmt.Errorf("error reading document id of %s: %w", receiptPath, err)
+	}
+
+	if err := id.checkMatches(xmlID); err != nil {
+		return DocumentID{}, err
+	}
+
+	return id, nil
+}
+
+func (id DocumentID) checkMatches(xmlID DocumentID) error {
+	var mismatches []string
+
+	if xmlID.RUC != "" && xmlID.RUC != id.RUC {
+		mismatches = append(mismatches, fmt.Sprintf("RUC %s != %s", id.RUC, xmlID.RUC))
+	}
+
+	if xmlID.Type != "" && xmlID.Type != id.Type {
+		mismatches = append(mismatches, fmt.Sprintf("type %s != %s", id.Type, xmlID.Type))
+	}
+
+	if xmlID.Series != id.Series {
+		mismatches = append(mismatches, fmt.Sprintf("series %s != %s", id.Series, xmlID.Series))
+	}
+
+	if !sameNumber(id.Number, xmlID.Number) {
+		mismatches = append(mismatches, fmt.Sprintf("number %s != %s", id.Number, xmlID.Number))
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%w '%s': %s", ErrDocumentIDMismatch, id, strings.Join(mismatches, ", "))
+	}
+
+	return nil
+}
+
+// sameNumber compares the correlativos ignoring leading zeros
+func sameNumber(a, b string) bool {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+
+	return na == nb
+}
@@ -0,0 +1,85 @@
+package sunat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const despatchAdviceXML = `<?xml version="1.0" encoding="UTF-8"?>
+<DespatchAdvice xmlns="urn:oasis:names:specification:ubl:schema:xsd:DespatchAdvice-2"
+	xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+	<cbc:UBLVersionID>2.1</cbc:UBLVersionID>
+	<cbc:ID>T001-00000042</cbc:ID>
+	<cbc:DespatchAdviceTypeCode>09</cbc:DespatchAdviceTypeCode>
+	<cac:DespatchSupplierParty>
+		<cac:Party>
+			<cac:PartyIdentification>
+				<cbc:ID schemeID="6">20123456789</cbc:ID>
+			</cac:PartyIdentification>
+		</cac:Party>
+	</cac:DespatchSupplierParty>
+	<cac:DeliveryCustomerParty>
+		<cac:Party>
+			<cac:PartyIdentification>
+				<cbc:ID schemeID="6">20987654321</cbc:ID>
+			</cac:PartyIdentification>
+		</cac:Party>
+	</cac:DeliveryCustomerParty>
+</DespatchAdvice>`
+
+func TestParseDocumentID(t *testing.T) {
+	id, err := ParseDocumentID("/tmp/20123456789-09-T001-1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DocumentID{RUC: "20123456789", Type: "09", Series: "T001", Number: "1"}
+	if id != expected {
+		t.Fatalf("expected %+v, got %+v", expected, id)
+	}
+
+	invalid := []string{
+		"2060.1-09-T001-1.xml",
+		"20123456789-09-T001.xml",
+		"20123456789-9-T001-1.xml",
+		"20123456789-09-t001-1.xml",
+		"20123456789-09-T001-123456789.xml",
+		"20123456789-09-T001-0.xml",
+	}
+
+	for _, name := range invalid {
+		if _, err := ParseDocumentID(name); !errors.Is(err, ErrInvalidDocumentID) {
+			t.Fatalf("expected ErrInvalidDocumentID for '%s', got %v", name, err)
+		}
+	}
+}
+
+func TestDocumentIDFromXML(t *testing.T) {
+	id, err := DocumentIDFromXML(strings.NewReader(despatchAdviceXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DocumentID{RUC: "20123456789", Type: "09", Series: "T001", Number: "00000042"}
+	if id != expected {
+		t.Fatalf("expected %+v, got %+v", expected, id)
+	}
+}
+
+func TestReceiptDocumentID(t *testing.T) {
+	if _, err := ReceiptDocumentID("20123456789-09-T001-42.xml", strings.NewReader(despatchAdviceXML)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ReceiptDocumentID("20123456789-09-T001-43.xml", strings.NewReader(despatchAdviceXML))
+	if !errors.Is(err, ErrDocumentIDMismatch) {
+		t.Fatalf("expected ErrDocumentIDMismatch, got %v", err)
+	}
+
+	_, err = ReceiptDocumentID("20999999999-09-T001-42.xml", strings.NewReader(despatchAdviceXML))
+	if !errors.Is(err, ErrDocumentIDMismatch) {
+		t.Fatalf("expected ErrDocumentIDMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package firma
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	ErrWrongPassword     = errors.New("wrong certificate password")
+	ErrNoPrivateKey      = errors.New("no private key found")
+	ErrNoCertificate     = errors.New("no certificate found")
+	ErrKeyMismatch       = errors.New("private key does not match the certificate")
+	ErrUnsupportedKey    = errors.New("only RSA keys are supported")
+	ErrEncryptedPKCS8    = errors.New("encrypted PKCS#8 keys are not supported, convert the key to PKCS#12 or decrypt it first")
+	ErrUnknownCertFormat = errors.New("unknown certificate format, use PKCS#12 (.p12, .pfx) or PEM")
+)
+
+// DefaultExpiryWarning is how long before its expiration a certificate
+// should be renewed
+const DefaultExpiryWarning = 30 * 24 * time.Hour
+
+// Certificate is the digital certificate used to sign the documents,
+// issued to the RUC of the issuer
+type Certificate struct {
+	PrivateKey *rsa.PrivateKey
+	Leaf       *x509.Certificate
+	// Intermediate certificates, if included in the file
+	Chain []*x509.Certificate
+}
+
+type LoadOptions struct {
+	// PEM file with the private key, when it is not in the same file as the
+	// certificate
+	KeyPath string
+	// Password of the PKCS#12 file or the encrypted PEM key
+	Password string
+}
+
+// LoadCertificate reads a PKCS#12 (.p12, .pfx) or PEM certificate with its
+// private key. The format is detected from the content of the file.
+func LoadCertificate(path string, opts LoadOptions) (*Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate: %w", err)
+	}
+
+	var cert *Certificate
+	if isPEM(data) {
+		if opts.KeyPath != "" {
+			keyData, err := os.ReadFile(opts.KeyPath)
+			if err != nil {
+				return nil, fmt.Errorf("error reading private key: %w", err)
+			}
+			data = append(append(data, '\n'), keyData...)
+		}
+		cert, err = ParsePEM(data, opts.Password)
+	} else {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".p12", ".pfx", "":
+			cert, err = ParsePKCS12(data, opts.Password)
+		default:
+			err = ErrUnknownCertFormat
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error loading certificate %s: %w", path, err)
+	}
+
+	return cert, nil
+}
+
+func isPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+// ParsePKCS12 decodes a PKCS#12 file with one private key and its
+// certificate chain
+func ParsePKCS12(data []byte, password string) (*Certificate, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, ErrWrongPassword
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newCertificate(key, leaf, chain)
+}
+
+// ParsePEM decodes PEM data that contains the certificate, the private key
+// and optionally intermediate certificates, in any order
+func ParsePEM(data []byte, password string) (*Certificate, error) {
+	var key any
+	var certs []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing certificate: %w", err)
+			}
+			certs = append(certs, c)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, ErrEncryptedPKCS8
+		case "RSA PRIVATE KEY", "PRIVATE KEY":
+			der := block.Bytes
+			// Legacy encryption (Proc-Type header), still used by some tools
+			// that export the certificates
+			if x509.IsEncryptedPEMBlock(block) {
+				var err error
+				der, err = x509.DecryptPEMBlock(block, []byte(password))
+				if err != nil {
+					return nil, ErrWrongPassword
+				}
+			}
+
+			k, err := parsePrivateKey(der)
+			if err != nil {
+				return nil, err
+			}
+			key = k
+		}
+	}
+
+	if key == nil {
+		return nil, ErrNoPrivateKey
+	}
+
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	if _, ok := key.(*rsa.PrivateKey); !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	// The leaf is the certificate of the private key, the others are
+	// intermediates
+	for i, c := range certs {
+		if publicKeyMatches(key, c) {
+			chain := append(append([]*x509.Certificate{}, certs[:i]...), certs[i+1:]...)
+			return newCertificate(key, c, chain)
+		}
+	}
+
+	return nil, ErrKeyMismatch
+}
+
+func parsePrivateKey(der []byte) (any, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+
+	return key, nil
+}
+
+func publicKeyMatches(key any, cert *x509.Certificate) bool {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return false
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+
+	return ok && rsaKey.PublicKey.Equal(pub)
+}
+
+func newCertificate(key any, leaf *x509.Certificate, chain []*x509.Certificate) (*Certificate, error) {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	if leaf == nil {
+		return nil, ErrNoCertificate
+	}
+
+	if !publicKeyMatches(rsaKey, leaf) {
+		return nil, ErrKeyMismatch
+	}
+
+	return &Certificate{PrivateKey: rsaKey, Leaf: leaf, Chain: chain}, nil
+}
+
+// RUCs returns the RUCs found in the subject of the certificate
+func (c *Certificate) RUCs() []string {
+	return CertificateRUCs(c.Leaf)
+}
+
+// CheckValidity returns ErrCertificateExpired or ErrCertificateNotYetValid
+// if the certificate cannot be used to sign at now
+func (c *Certificate) CheckValidity(now time.Time) error {
+	return checkValidity(c.Leaf, now)
+}
+
+// ExpiresWithin reports whether the certificate expires before now plus
+// window, so it can be renewed in time
+func (c *Certificate) ExpiresWithin(now time.Time, window time.Duration) bool {
+	return now.Add(window).After(c.Leaf.NotAfter)
+}
+
+func checkValidity(cert *x509.Certificate, now time.Time) error {
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("%w: valid from %s", ErrCertificateNotYetValid, cert.NotBefore.Format(time.DateTime))
+	}
+
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: valid until %s", ErrCertificateExpired, cert.NotAfter.Format(time.DateTime))
+	}
+
+	return nil
+}
+
+// EncodePKCS12 returns the certificate, its chain and private key as a
+// PKCS#12 file protected with password
+func EncodePKCS12(c *Certificate, password string) ([]byte, error) {
+	pfx, err := pkcs12.Modern.Encode(c.PrivateKey, c.Leaf, c.Chain, password)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding PKCS#12: %w", err)
+	}
+
+	return pfx, nil
+}
+
+// EncodePEM returns the certificate, its chain and the unencrypted private
+// key (PKCS#8) as PEM blocks
+func EncodePEM(c *Certificate) ([]byte, error) {
+	key, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding private key: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for _, cert := range append([]*x509.Certificate{c.Leaf}, c.Chain...) {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: key}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
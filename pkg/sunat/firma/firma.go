@@ -0,0 +1,259 @@
+// Package firma signs electronic documents with an enveloped XML digital
+// signature (XMLDSig), as required by SUNAT. The signature uses exclusive
+// canonicalization and RSA-SHA256, and is placed inside
+// ext:UBLExtensions/ext:UBLExtension/ext:ExtensionContent. The document
+// references it from its cac:Signature block.
+package firma
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/haguirrear/sunatapi/pkg/ubl"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	NamespaceEXT = "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2"
+	// Id of the ds:Signature element, referenced from cac:Signature
+	DefaultSignatureID = "SignatureSP"
+)
+
+var (
+	ErrAlreadySigned = errors.New("document is already signed")
+	ErrNoRootElement = errors.New("document has no root element")
+	// The cac:Signature of the document references another signature
+	ErrSignatureReferenceMismatch = errors.New("cac:Signature does not reference the signature")
+)
+
+type SignOptions struct {
+	// Defaults to DefaultSignatureID
+	SignatureID string
+}
+
+func (o SignOptions) signatureID() string {
+	if o.SignatureID == "" {
+		return DefaultSignatureID
+	}
+
+	return o.SignatureID
+}
+
+// Sign returns xmlContent with an enveloped signature made with cert. If
+// the document has no cac:Signature, one referencing the signature is
+// added with the RUC and name of the issuer.
+func Sign(xmlContent []byte, cert *Certificate, opts SignOptions) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlContent); err != nil {
+		return nil, fmt.Errorf("error reading xml: %w", err)
+	}
+
+	root := doc.Root()
+	if root == nil {
+		return nil, ErrNoRootElement
+	}
+
+	if findSignature(root) != nil {
+		return nil, ErrAlreadySigned
+	}
+
+	// The content and the reference must exist before computing the digest,
+	// as the enveloped transform only removes the signature itself
+	content := extensionContent(root)
+	if err := signatureReference(root, opts.signatureID(), cert); err != nil {
+		return nil, err
+	}
+
+	ctx, err := dsig.NewSigningContext(cert.PrivateKey, [][]byte{cert.Leaf.Raw})
+	if err != nil {
+		return nil, fmt.Errorf("error signing xml: %w", err)
+	}
+
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	if err := ctx.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+		return nil, fmt.Errorf("error signing xml: %w", err)
+	}
+
+	// The canonicalizer rewrites the namespace declarations of the element
+	// it digests, so a copy is signed to keep the document as it was written
+	signature, err := ctx.ConstructSignature(root.Copy(), true)
+	if err != nil {
+		return nil, fmt.Errorf("error signing xml: %w", err)
+	}
+
+	signature.CreateAttr("Id", opts.signatureID())
+	content.AddChild(signature)
+
+	signed, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("error writing signed xml: %w", err)
+	}
+
+	return signed, nil
+}
+
+// findSignature returns the first ds:Signature in the document, nil if
+// it is not signed
+func findSignature(root *etree.Element) *etree.Element {
+	for _, el := range root.FindElements("//Signature") {
+		if el.NamespaceURI() == dsig.Namespace {
+			return el
+		}
+	}
+
+	return nil
+}
+
+// extensionContent returns an empty ext:ExtensionContent where the
+// signature can be placed, creating ext:UBLExtensions as the first child
+// of root if it does not exist
+func extensionContent(root *etree.Element) *etree.Element {
+	prefix := declarePrefix(root, NamespaceEXT, "ext")
+
+	var extensions *etree.Element
+	for _, el := range root.ChildElements() {
+		if el.Tag == "UBLExtensions" && el.NamespaceURI() == NamespaceEXT {
+			extensions = el
+			break
+		}
+	}
+
+	if extensions == nil {
+		extensions = etree.NewElement(prefix + ":UBLExtensions")
+		root.InsertChildAt(0, extensions)
+	}
+
+	for _, extension := range extensions.ChildElements() {
+		for _, content := range extension.ChildElements() {
+			if content.Tag == "ExtensionContent" && len(content.ChildElements()) == 0 {
+				return content
+			}
+		}
+	}
+
+	extension := extensions.CreateElement(prefix + ":UBLExtension")
+
+	return extension.CreateElement(prefix + ":ExtensionContent")
+}
+
+// signatureReference checks that the cac:Signature of root references the
+// signature with id, creating it before the supplier party if there is none:
+//
+//	<cac:Signature>
+//	  <cbc:ID>SignatureSP</cbc:ID>
+//	  <cac:SignatoryParty>
+//	    <cac:PartyIdentification><cbc:ID>RUC</cbc:ID></cac:PartyIdentification>
+//	    <cac:PartyName><cbc:Name>Razón social</cbc:Name></cac:PartyName>
+//	  </cac:SignatoryParty>
+//	  <cac:DigitalSignatureAttachment>
+//	    <cac:ExternalReference><cbc:URI>#SignatureSP</cbc:URI></cac:ExternalReference>
+//	  </cac:DigitalSignatureAttachment>
+//	</cac:Signature>
+func signatureReference(root *etree.Element, id string, cert *Certificate) error {
+	var uris []string
+	for _, el := range root.ChildElements() {
+		if el.Tag != "Signature" || el.NamespaceURI() != ubl.NamespaceCAC {
+			continue
+		}
+
+		uri := ""
+		if ref := el.FindElement("./DigitalSignatureAttachment/ExternalReference/URI"); ref != nil {
+			uri = strings.TrimSpace(ref.Text())
+		}
+
+		if uri == "#"+id {
+			return nil
+		}
+
+		uris = append(uris, uri)
+	}
+
+	if len(uris) > 0 {
+		return fmt.Errorf("%w: expected #%s, got %s", ErrSignatureReferenceMismatch, id, strings.Join(uris, ", "))
+	}
+
+	cac := declarePrefix(root, ubl.NamespaceCAC, "cac")
+	cbc := declarePrefix(root, ubl.NamespaceCBC, "cbc")
+
+	ruc, name := issuer(root)
+	if rucs := cert.RUCs(); ruc == "" && len(rucs) > 0 {
+		ruc = rucs[0]
+	}
+	if name == "" {
+		name = cert.Leaf.Subject.CommonName
+	}
+
+	signature := etree.NewElement(cac + ":Signature")
+	signature.CreateElement(cbc + ":ID").SetText(id)
+
+	party := signature.CreateElement(cac + ":SignatoryParty")
+	party.CreateElement(cac + ":PartyIdentification").CreateElement(cbc + ":ID").SetText(ruc)
+	if name != "" {
+		party.CreateElement(cac + ":PartyName").CreateElement(cbc + ":Name").SetText(name)
+	}
+
+	signature.CreateElement(cac + ":DigitalSignatureAttachment").
+		CreateElement(cac + ":ExternalReference").
+		CreateElement(cbc + ":URI").SetText("#" + id)
+
+	// UBL places cac:Signature right before the supplier party
+	for _, el := range root.ChildElements() {
+		if strings.HasSuffix(el.Tag, "SupplierParty") && el.NamespaceURI() == ubl.NamespaceCAC {
+			root.InsertChildAt(el.Index(), signature)
+			return nil
+		}
+	}
+
+	root.AddChild(signature)
+
+	return nil
+}
+
+// issuer returns the RUC and name of the supplier party of root, if any
+func issuer(root *etree.Element) (ruc, name string) {
+	for _, el := range root.ChildElements() {
+		if !strings.HasSuffix(el.Tag, "SupplierParty") || el.NamespaceURI() != ubl.NamespaceCAC {
+			continue
+		}
+
+		if id := el.FindElement("./Party/PartyIdentification/ID"); id != nil {
+			ruc = strings.TrimSpace(id.Text())
+		}
+
+		for _, path := range []string{"./Party/PartyLegalEntity/RegistrationName", "./Party/PartyName/Name"} {
+			if n := el.FindElement(path); n != nil && strings.TrimSpace(n.Text()) != "" {
+				name = strings.TrimSpace(n.Text())
+				break
+			}
+		}
+
+		return ruc, name
+	}
+
+	return "", ""
+}
+
+// declarePrefix returns the prefix declared in root for namespace,
+// declaring it with prefix if there is none
+func declarePrefix(root *etree.Element, namespace, prefix string) string {
+	if declared := namespacePrefix(root, namespace); declared != "" {
+		return declared
+	}
+
+	root.CreateAttr("xmlns:"+prefix, namespace)
+
+	return prefix
+}
+
+// namespacePrefix returns the prefix declared in root for namespace
+func namespacePrefix(root *etree.Element, namespace string) string {
+	for _, attr := range root.Attr {
+		if attr.Space == "xmlns" && attr.Value == namespace {
+			return attr.Key
+		}
+	}
+
+	return ""
+}
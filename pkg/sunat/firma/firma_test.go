@@ -0,0 +1,235 @@
+package firma
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/haguirrear/sunatapi/pkg/ubl"
+	dsig "github.com/russellhaering/goxmldsig"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func newTestCertificate(t *testing.T) *Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "EMPRESA DE PRUEBA S.A.C.", SerialNumber: "20123456789"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Certificate{PrivateKey: key, Leaf: leaf}
+}
+
+func TestSign(t *testing.T) {
+	cert := newTestCertificate(t)
+
+	content, err := os.ReadFile("testdata/20123456789-09-T001-1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := Sign(content, cert, SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ubl.ValidateDespatchAdvice(bytes.NewReader(signed)); err != nil {
+		t.Fatalf("signed document is not valid: %v", err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(signed); err != nil {
+		t.Fatal(err)
+	}
+
+	sig := doc.FindElement("/DespatchAdvice/UBLExtensions/UBLExtension/ExtensionContent/Signature")
+	if sig == nil {
+		t.Fatalf("signature not found inside ext:ExtensionContent:\n%s", signed)
+	}
+
+	if id := sig.SelectAttrValue("Id", ""); id != DefaultSignatureID {
+		t.Fatalf("expected signature Id '%s', got '%s'", DefaultSignatureID, id)
+	}
+
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert.Leaf}})
+	if _, err := ctx.Validate(doc.Root()); err != nil {
+		t.Fatalf("invalid signature: %v", err)
+	}
+
+	ref := doc.FindElement("/DespatchAdvice/Signature")
+	if ref == nil {
+		t.Fatalf("cac:Signature not found:\n%s", signed)
+	}
+
+	expected := map[string]string{
+		"./ID": DefaultSignatureID,
+		"./SignatoryParty/PartyIdentification/ID":            "20123456789",
+		"./SignatoryParty/PartyName/Name":                    "EMPRESA DE PRUEBA S.A.C.",
+		"./DigitalSignatureAttachment/ExternalReference/URI": "#" + DefaultSignatureID,
+	}
+	for path, value := range expected {
+		if el := ref.FindElement(path); el == nil || el.Text() != value {
+			t.Fatalf("expected cac:Signature%s to be '%s', got %v", path[1:], value, el)
+		}
+	}
+
+	children := doc.Root().ChildElements()
+	for i, child := range children {
+		if child == ref && (i+1 == len(children) || children[i+1].Tag != "DespatchSupplierParty") {
+			t.Fatal("expected cac:Signature before cac:DespatchSupplierParty")
+		}
+	}
+
+	if _, err := Sign(signed, cert, SignOptions{}); !errors.Is(err, ErrAlreadySigned) {
+		t.Fatalf("expected ErrAlreadySigned, got %v", err)
+	}
+}
+
+func TestSignExistingSignatureReference(t *testing.T) {
+	cert := newTestCertificate(t)
+
+	content, err := os.ReadFile("testdata/20123456789-09-T001-1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withReference := func(uri string) []byte {
+		ref := `<cac:Signature><cbc:ID>IDSign</cbc:ID><cac:DigitalSignatureAttachment><cac:ExternalReference><cbc:URI>` + uri + `</cbc:URI></cac:ExternalReference></cac:DigitalSignatureAttachment></cac:Signature>`
+		return bytes.Replace(content, []byte("<cac:DespatchSupplierParty>"), []byte(ref+"<cac:DespatchSupplierParty>"), 1)
+	}
+
+	signed, err := Sign(withReference("#SignatureSP"), cert, SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(signed); err != nil {
+		t.Fatal(err)
+	}
+
+	if refs := doc.FindElements("/DespatchAdvice/Signature"); len(refs) != 1 {
+		t.Fatalf("expected the existing cac:Signature to be kept, got %d", len(refs))
+	}
+
+	if _, err := Sign(withReference("#OtraFirma"), cert, SignOptions{}); !errors.Is(err, ErrSignatureReferenceMismatch) {
+		t.Fatalf("expected ErrSignatureReferenceMismatch, got %v", err)
+	}
+}
+
+func TestLoadCertificate(t *testing.T) {
+	cert := newTestCertificate(t)
+	dir := t.TempDir()
+
+	pfx, err := pkcs12.Modern.Encode(cert.PrivateKey, cert.Leaf, nil, "secreto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p12Path := filepath.Join(dir, "cert.p12")
+	if err := os.WriteFile(p12Path, pfx, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCertificate(p12Path, LoadOptions{Password: "secreto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.Leaf.Equal(cert.Leaf) {
+		t.Fatal("loaded certificate does not match")
+	}
+
+	if _, err := LoadCertificate(p12Path, LoadOptions{Password: "otro"}); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Leaf.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(cert.PrivateKey)})
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadCertificate(certPath, LoadOptions{}); !errors.Is(err, ErrNoPrivateKey) {
+		t.Fatalf("expected ErrNoPrivateKey, got %v", err)
+	}
+
+	loaded, err = LoadCertificate(certPath, LoadOptions{KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.PrivateKey.Equal(cert.PrivateKey) {
+		t.Fatal("loaded private key does not match")
+	}
+}
+
+func TestEncodeCertificate(t *testing.T) {
+	cert := newTestCertificate(t)
+
+	pfx, err := EncodePKCS12(cert, "secreto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromPFX, err := ParsePKCS12(pfx, "secreto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemData, err := EncodePEM(fromPFX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromPEM, err := ParsePEM(pemData, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fromPEM.Leaf.Equal(cert.Leaf) || !fromPEM.PrivateKey.Equal(cert.PrivateKey) {
+		t.Fatal("certificate changed after converting to PKCS#12 and PEM")
+	}
+
+	if rucs := fromPEM.RUCs(); len(rucs) != 1 || rucs[0] != "20123456789" {
+		t.Fatalf("unexpected RUCs %v", rucs)
+	}
+
+	if !cert.ExpiresWithin(time.Now(), DefaultExpiryWarning) || cert.ExpiresWithin(time.Now(), time.Hour) {
+		t.Fatal("unexpected expiry warning")
+	}
+}
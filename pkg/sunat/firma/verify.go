@@ -0,0 +1,334 @@
+package firma
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// Errors returned by Verify, one per check. They are wrapped with the
+// detail of the failure, use errors.Is to know which check failed.
+var (
+	ErrNotSigned              = errors.New("document is not signed")
+	ErrMalformedSignature     = errors.New("malformed signature")
+	ErrUnsupportedAlgorithm   = errors.New("unsupported algorithm")
+	ErrDigestMismatch         = errors.New("reference digest does not match, the document was modified after signing")
+	ErrInvalidSignatureValue  = errors.New("invalid signature value, the signed info was modified or the certificate does not match")
+	ErrCertificateNotYetValid = errors.New("certificate is not valid yet")
+	ErrCertificateExpired     = errors.New("certificate is expired")
+	ErrCertificateRUCMismatch = errors.New("certificate was not issued to the RUC of the issuer")
+)
+
+var digestMethods = map[string]crypto.Hash{
+	"http://www.w3.org/2000/09/xmldsig#sha1":  crypto.SHA1,
+	"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+	"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+}
+
+var signatureMethods = map[string]crypto.Hash{
+	dsig.RSASHA1SignatureMethod:   crypto.SHA1,
+	dsig.RSASHA256SignatureMethod: crypto.SHA256,
+	dsig.RSASHA512SignatureMethod: crypto.SHA512,
+}
+
+var rucRegex = regexp.MustCompile(`(10|15|16|17|20)[0-9]{9}`)
+
+type VerifyOptions struct {
+	// RUC of the issuer of the document, the certificate must be issued to
+	// it. Not checked if empty.
+	RUC string
+	// Time used to check the validity period of the certificate, defaults
+	// to now
+	Now time.Time
+}
+
+// Verification is the result of a successful Verify
+type Verification struct {
+	SignatureID string
+	Certificate *x509.Certificate
+	// RUCs found in the subject of the certificate
+	CertificateRUCs []string
+}
+
+// Verify checks the enveloped signature of xmlContent: the reference
+// digest, the signature value, the validity period of the certificate and
+// that it was issued to opts.RUC
+func Verify(xmlContent []byte, opts VerifyOptions) (*Verification, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlContent); err != nil {
+		return nil, fmt.Errorf("error reading xml: %w", err)
+	}
+
+	root := doc.Root()
+	if root == nil {
+		return nil, ErrNoRootElement
+	}
+
+	signature := findSignature(root)
+	if signature == nil {
+		return nil, ErrNotSigned
+	}
+
+	signedInfo := childElement(signature, "SignedInfo")
+	signatureValue := childElement(signature, "SignatureValue")
+	if signedInfo == nil || signatureValue == nil {
+		return nil, fmt.Errorf("%w: missing ds:SignedInfo or ds:SignatureValue", ErrMalformedSignature)
+	}
+
+	cert, err := signatureCertificate(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyReference(root, signedInfo); err != nil {
+		return nil, err
+	}
+
+	if err := verifySignatureValue(signedInfo, signatureValue, cert); err != nil {
+		return nil, err
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if err := checkValidity(cert, now); err != nil {
+		return nil, err
+	}
+
+	rucs := CertificateRUCs(cert)
+	if opts.RUC != "" && !containsString(rucs, opts.RUC) {
+		return nil, fmt.Errorf("%w: expected %s, certificate subject is '%s'", ErrCertificateRUCMismatch, opts.RUC, cert.Subject.String())
+	}
+
+	return &Verification{
+		SignatureID:     signature.SelectAttrValue("Id", ""),
+		Certificate:     cert,
+		CertificateRUCs: rucs,
+	}, nil
+}
+
+// CertificateRUCs returns the RUCs found in the subject of cert. SUNAT
+// certificates include it in the serial number, common name or
+// organizational unit, depending on the certification authority.
+func CertificateRUCs(cert *x509.Certificate) []string {
+	var rucs []string
+	for _, name := range cert.Subject.Names {
+		value, ok := name.Value.(string)
+		if !ok {
+			continue
+		}
+
+		for _, ruc := range rucRegex.FindAllString(value, -1) {
+			if !containsString(rucs, ruc) {
+				rucs = append(rucs, ruc)
+			}
+		}
+	}
+
+	return rucs
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// childElement returns the first ds child of el with the tag local
+func childElement(el *etree.Element, local string) *etree.Element {
+	for _, c := range el.ChildElements() {
+		if c.Tag == local && c.NamespaceURI() == dsig.Namespace {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func algorithm(el *etree.Element, local string) string {
+	if c := childElement(el, local); c != nil {
+		return c.SelectAttrValue("Algorithm", "")
+	}
+
+	return ""
+}
+
+func canonicalizer(alg string) (dsig.Canonicalizer, error) {
+	switch dsig.AlgorithmID(alg) {
+	case dsig.CanonicalXML10ExclusiveAlgorithmId:
+		return dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""), nil
+	case dsig.CanonicalXML10ExclusiveWithCommentsAlgorithmId:
+		return dsig.MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList(""), nil
+	case dsig.CanonicalXML10RecAlgorithmId:
+		return dsig.MakeC14N10RecCanonicalizer(), nil
+	case dsig.CanonicalXML10WithCommentsAlgorithmId:
+		return dsig.MakeC14N10WithCommentsCanonicalizer(), nil
+	case dsig.CanonicalXML11AlgorithmId:
+		return dsig.MakeC14N11Canonicalizer(), nil
+	case dsig.CanonicalXML11WithCommentsAlgorithmId:
+		return dsig.MakeC14N11WithCommentsCanonicalizer(), nil
+	default:
+		return nil, fmt.Errorf("%w: canonicalization '%s'", ErrUnsupportedAlgorithm, alg)
+	}
+}
+
+func signatureCertificate(signature *etree.Element) (*x509.Certificate, error) {
+	var certEl *etree.Element
+	if keyInfo := childElement(signature, "KeyInfo"); keyInfo != nil {
+		if x509Data := childElement(keyInfo, "X509Data"); x509Data != nil {
+			certEl = childElement(x509Data, "X509Certificate")
+		}
+	}
+
+	if certEl == nil {
+		return nil, fmt.Errorf("%w: missing ds:KeyInfo/ds:X509Data/ds:X509Certificate", ErrMalformedSignature)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(certEl.Text()), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding certificate: %v", ErrMalformedSignature, err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error parsing certificate: %v", ErrMalformedSignature, err)
+	}
+
+	return cert, nil
+}
+
+// verifyReference applies the transforms of the reference to the whole
+// document and compares its digest
+func verifyReference(root, signedInfo *etree.Element) error {
+	reference := childElement(signedInfo, "Reference")
+	if reference == nil {
+		return fmt.Errorf("%w: missing ds:Reference", ErrMalformedSignature)
+	}
+
+	if uri := reference.SelectAttrValue("URI", ""); uri != "" {
+		return fmt.Errorf("%w: reference URI '%s', only enveloped signatures of the whole document (URI=\"\") are supported", ErrUnsupportedAlgorithm, uri)
+	}
+
+	hash, ok := digestMethods[algorithm(reference, "DigestMethod")]
+	if !ok {
+		return fmt.Errorf("%w: digest '%s'", ErrUnsupportedAlgorithm, algorithm(reference, "DigestMethod"))
+	}
+
+	expected := childElement(reference, "DigestValue")
+	if expected == nil {
+		return fmt.Errorf("%w: missing ds:DigestValue", ErrMalformedSignature)
+	}
+
+	// The transforms are applied to a copy, as the canonicalizers modify
+	// the element
+	target := root.Copy()
+	enveloped := false
+	var c14n dsig.Canonicalizer
+
+	if transforms := childElement(reference, "Transforms"); transforms != nil {
+		for _, t := range transforms.ChildElements() {
+			alg := t.SelectAttrValue("Algorithm", "")
+			if alg == dsig.EnvelopedSignatureAltorithmId.String() {
+				enveloped = true
+				continue
+			}
+
+			var err error
+			c14n, err = canonicalizer(alg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if enveloped {
+		if sig := findSignature(target); sig != nil {
+			sig.Parent().RemoveChild(sig)
+		}
+	}
+
+	if c14n == nil {
+		// Default canonicalization of XMLDSig
+		c14n = dsig.MakeC14N10RecCanonicalizer()
+	}
+
+	canonical, err := c14n.Canonicalize(target)
+	if err != nil {
+		return fmt.Errorf("%w: error canonicalizing document: %v", ErrMalformedSignature, err)
+	}
+
+	h := hash.New()
+	h.Write(canonical)
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	if digest != strings.TrimSpace(expected.Text()) {
+		return fmt.Errorf("%w: expected %s, computed %s", ErrDigestMismatch, strings.TrimSpace(expected.Text()), digest)
+	}
+
+	return nil
+}
+
+// verifySignatureValue checks the signature of the canonical SignedInfo
+// with the public key of cert
+func verifySignatureValue(signedInfo, signatureValue *etree.Element, cert *x509.Certificate) error {
+	c14n, err := canonicalizer(algorithm(signedInfo, "CanonicalizationMethod"))
+	if err != nil {
+		return err
+	}
+
+	hash, ok := signatureMethods[algorithm(signedInfo, "SignatureMethod")]
+	if !ok {
+		return fmt.Errorf("%w: signature method '%s'", ErrUnsupportedAlgorithm, algorithm(signedInfo, "SignatureMethod"))
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: certificate key", ErrUnsupportedKey)
+	}
+
+	// SignedInfo is canonicalized with the namespaces in scope where it is
+	// placed in the document
+	nsCtx, err := etreeutils.NSBuildParentContext(signedInfo)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
+	}
+
+	detached, err := etreeutils.NSDetatch(nsCtx, signedInfo)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
+	}
+
+	canonical, err := c14n.Canonicalize(detached)
+	if err != nil {
+		return fmt.Errorf("%w: error canonicalizing ds:SignedInfo: %v", ErrMalformedSignature, err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signatureValue.Text()), ""))
+	if err != nil {
+		return fmt.Errorf("%w: error decoding ds:SignatureValue: %v", ErrMalformedSignature, err)
+	}
+
+	h := hash.New()
+	h.Write(canonical)
+	if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), value); err != nil {
+		return ErrInvalidSignatureValue
+	}
+
+	return nil
+}
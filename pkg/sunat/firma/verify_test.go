@@ -0,0 +1,73 @@
+package firma
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	cert := newTestCertificate(t)
+
+	content, err := os.ReadFile("testdata/20123456789-09-T001-1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := Sign(content, cert, SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := Verify(signed, VerifyOptions{RUC: "20123456789"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.SignatureID != DefaultSignatureID || !v.Certificate.Equal(cert.Leaf) {
+		t.Fatalf("unexpected verification %+v", v)
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		opts     VerifyOptions
+		expected error
+	}{
+		{
+			name:     "unsigned",
+			content:  content,
+			expected: ErrNotSigned,
+		},
+		{
+			name:     "modified content",
+			content:  bytes.Replace(signed, []byte("CAJA DE PRODUCTOS"), []byte("CAJA DE PRODUCTOZ"), 1),
+			expected: ErrDigestMismatch,
+		},
+		{
+			name:     "modified signed info",
+			content:  bytes.Replace(signed, []byte(`Id="SignatureSP"><ds:SignedInfo>`), []byte(`Id="SignatureSP"><ds:SignedInfo xml:lang="es">`), 1),
+			expected: ErrInvalidSignatureValue,
+		},
+		{
+			name:     "expired certificate",
+			content:  signed,
+			opts:     VerifyOptions{Now: time.Now().Add(48 * time.Hour)},
+			expected: ErrCertificateExpired,
+		},
+		{
+			name:     "other RUC",
+			content:  signed,
+			opts:     VerifyOptions{RUC: "20987654321"},
+			expected: ErrCertificateRUCMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		if _, err := Verify(tt.content, tt.opts); !errors.Is(err, tt.expected) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -49,8 +48,8 @@ func (r GetReceiptResponse) IsCdrGenerated() (bool, error) {
 	return strconv.ParseBool(r.CdrGenerated)
 }
 
-func (s Sunat) GetReceipt(ctx context.Context, baseURL string, token string, ticket string) (GetReceiptResponse, error) {
-	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+func (s Sunat) GetReceipt(ctx context.Context, baseURL string, ticket string) (GetReceiptResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
 	defer cancel()
 
 	reqURL := fmt.Sprintf("%s/v1/contribuyente/gem/comprobantes/envios/%s", baseURL, ticket)
@@ -60,10 +59,7 @@ func (s Sunat) GetReceipt(ctx context.Context, baseURL string, token string, tic
 		return GetReceiptResponse{}, fmt.Errorf("error building request for getting receipt: %s: %w", ticket, err)
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	// res, err := client.Do(req)
-	res, err := s.doRequest(client, req)
+	res, err := s.doAuthorizedRequest(req, queryEndpoint)
 	if err != nil {
 		return GetReceiptResponse{}, fmt.Errorf("error getting receipt %s: %w", ticket, err)
 	}
@@ -76,7 +72,7 @@ func (s Sunat) GetReceipt(ctx context.Context, baseURL string, token string, tic
 	}
 
 	if res.StatusCode >= 400 {
-		return GetReceiptResponse{}, fmt.Errorf("error getting receipt %s: %s | %s", ticket, res.Status, string(body))
+		return GetReceiptResponse{}, fmt.Errorf("error getting receipt %s: %w", ticket, newAPIError(res, body))
 	}
 
 	var resBody GetReceiptResponse
@@ -84,6 +80,12 @@ func (s Sunat) GetReceipt(ctx context.Context, baseURL string, token string, tic
 		return GetReceiptResponse{}, fmt.Errorf("error parsing body while getting receipt %s, status %s: %w\nBody: %s", ticket, res.Status, err, string(body))
 	}
 
+	if s.SendLog != nil {
+		if err := s.SendLog.RecordResult(ctx, ticket, resBody); err != nil {
+			s.log().Warnf("Could not update send record: %v", err)
+		}
+	}
+
 	return resBody, nil
 }
 
@@ -136,12 +138,12 @@ func SaveReceipt(receiptB64 string, outputFolder string) error {
 	return nil
 }
 
-func (s Sunat) PollReceipt(ctx context.Context, baseURL, token, ticket string) (GetReceiptResponse, error) {
+func (s Sunat) PollReceipt(ctx context.Context, baseURL, ticket string) (GetReceiptResponse, error) {
 	for {
-		s.Logger.Debug("Trying to get Receipt")
-		r, err := s.GetReceipt(ctx, baseURL, token, ticket)
+		s.log().Debug("Trying to get Receipt")
+		r, err := s.GetReceipt(ctx, baseURL, ticket)
 		if err != nil {
-			s.Logger.Errorf("Error: %v", err)
+			s.log().Errorf("Error: %v", err)
 		}
 
 		if !r.IsProcessing() {
@@ -150,10 +152,8 @@ func (s Sunat) PollReceipt(ctx context.Context, baseURL, token, ticket string) (
 
 		select {
 		case <-ctx.Done():
-			return r, errors.New("Timeout")
-		default:
-			time.Sleep(200 * time.Millisecond)
+			return r, fmt.Errorf("timeout waiting for receipt %s: %w", ticket, ctx.Err())
+		case <-time.After(200 * time.Millisecond):
 		}
-
 	}
 }
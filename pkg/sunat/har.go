@@ -0,0 +1,449 @@
+package sunat
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haguirrear/sunatapi/pkg/logger"
+)
+
+// JSON keys that contain base64 encoded zip files
+var payloadJSONKeys = []string{"arcGreZip", "arcCdr"}
+
+// Number of characters kept when truncating payloads
+const truncatedPayloadLength = 64
+
+// HAROptions configures a HARRecorder
+type HAROptions struct {
+	// Name and version of the application, saved in the creator field
+	CreatorName    string
+	CreatorVersion string
+	// Truncate the base64 encoded zip files sent and received to keep the
+	// file small
+	TruncatePayloads bool
+}
+
+// HARRecorder records the HTTP exchanges with SUNAT in a HAR 1.2 file.
+// Passwords, client secrets and tokens are masked. Each exchange is appended
+// to the file as soon as it finishes, followed by the end of the JSON
+// document, so the file is complete even if the process exits abruptly. It
+// is safe for concurrent use.
+type HARRecorder struct {
+	path string
+	opts HAROptions
+
+	mu   sync.Mutex
+	file *os.File
+	// Offset where the next entry is written, over the end of the document
+	offset  int64
+	entries int
+	closed  bool
+}
+
+func NewHARRecorder(path string, opts HAROptions) *HARRecorder {
+	if opts.CreatorName == "" {
+		opts.CreatorName = "sunatapi"
+	}
+
+	return &HARRecorder{path: path, opts: opts}
+}
+
+type harLog struct {
+	Log harContent `json:"log"`
+}
+
+type harContent struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harBody        `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harBody struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// Durations in milliseconds, -1 when they do not apply
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harTrace collects the timestamps of the phases of a request
+type harTrace struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	dnsStart, dnsDone      time.Time
+	connectStart, connDone time.Time
+	tlsStart, tlsDone      time.Time
+	wroteRequest           time.Time
+	firstByte              time.Time
+	done                   time.Time
+}
+
+func (t *harTrace) set(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*field = time.Now()
+}
+
+// withHARTrace returns a copy of req that collects its timings
+func withHARTrace(req *http.Request) (*http.Request, *harTrace) {
+	t := &harTrace{start: time.Now()}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.set(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.set(&t.connDone) },
+		TLSHandshakeStart:    func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+func millis(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return -1
+	}
+
+	return float64(to.Sub(from).Microseconds()) / 1000
+}
+
+func (t *harTrace) timings() harTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings := harTimings{
+		Blocked: -1,
+		DNS:     millis(t.dnsStart, t.dnsDone),
+		Connect: millis(t.connectStart, t.connDone),
+		SSL:     millis(t.tlsStart, t.tlsDone),
+		Send:    0,
+		Wait:    millis(t.wroteRequest, t.firstByte),
+		Receive: millis(t.firstByte, t.done),
+	}
+
+	// The connection was reused, the time until sending the request was
+	// spent waiting for it
+	if timings.Connect < 0 && !t.wroteRequest.IsZero() {
+		timings.Blocked = millis(t.start, t.wroteRequest)
+	}
+
+	if timings.Wait < 0 {
+		timings.Wait = millis(t.start, t.done)
+	}
+
+	if timings.Receive < 0 {
+		timings.Receive = 0
+	}
+
+	return timings
+}
+
+func toNameValues(redactor *Redactor, h http.Header) []harNameValue {
+	values := []harNameValue{}
+	for name, vs := range redactor.HeaderMap(h) {
+		for _, v := range vs {
+			values = append(values, harNameValue{Name: name, Value: v})
+		}
+	}
+
+	return values
+}
+
+// truncatePayloads shortens the base64 zip files in a JSON body
+func truncatePayloads(body []byte) []byte {
+	var parsed any
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return body
+	}
+
+	var truncate func(v any) bool
+	truncate = func(v any) bool {
+		changed := false
+		switch v := v.(type) {
+		case map[string]any:
+			for key, value := range v {
+				if str, ok := value.(string); ok && containsFold(payloadJSONKeys, key) && len(str) > truncatedPayloadLength {
+					v[key] = fmt.Sprintf("%s...(%d bytes truncated)", str[:truncatedPayloadLength], len(str)-truncatedPayloadLength)
+					changed = true
+					continue
+				}
+
+				changed = truncate(value) || changed
+			}
+		case []any:
+			for _, value := range v {
+				changed = truncate(value) || changed
+			}
+		}
+
+		return changed
+	}
+
+	if !truncate(parsed) {
+		return body
+	}
+
+	truncated, err := json.Marshal(parsed)
+	if err != nil {
+		return body
+	}
+
+	return truncated
+}
+
+func (r *HARRecorder) bodyText(redactor *Redactor, contentType string, body []byte) string {
+	body = redactor.Body(contentType, body)
+	if r.opts.TruncatePayloads && strings.Contains(contentType, "json") {
+		body = truncatePayloads(body)
+	}
+
+	return string(body)
+}
+
+// record appends an exchange to the HAR file. res is nil if the request
+// failed. Secrets are always masked, even if redactor is disabled for logs.
+func (r *HARRecorder) record(redactor *Redactor, req *http.Request, reqBody []byte, res *http.Response, resBody []byte, reqErr error, trace *harTrace) error {
+	redactor = redactor.enabled()
+
+	trace.set(&trace.done)
+	timings := trace.timings()
+
+	entry := harEntry{
+		StartedDateTime: trace.start.Format(time.RFC3339Nano),
+		Time:            millis(trace.start, trace.done),
+		Timings:         timings,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         redactor.URL(req.URL),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     toNameValues(redactor, req.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: v})
+		}
+	}
+
+	if reqBody != nil {
+		contentType := req.Header.Get("Content-Type")
+		entry.Request.PostData = &harPostData{
+			MimeType: contentType,
+			Text:     r.bodyText(redactor, contentType, reqBody),
+		}
+	}
+
+	if reqErr != nil {
+		entry.Error = reqErr.Error()
+	}
+
+	if res != nil {
+		contentType := res.Header.Get("Content-Type")
+		entry.Response.Status = res.StatusCode
+		entry.Response.StatusText = strings.TrimSpace(strings.TrimPrefix(res.Status, fmt.Sprint(res.StatusCode)))
+		entry.Response.HTTPVersion = res.Proto
+		entry.Response.Headers = toNameValues(redactor, res.Header)
+		entry.Response.BodySize = len(resBody)
+		entry.Response.Content = harBody{
+			Size:     len(resBody),
+			MimeType: contentType,
+			Text:     r.bodyText(redactor, contentType, resBody),
+		}
+	}
+
+	return r.append(entry)
+}
+
+// End of the HAR document, written after the last entry
+const harFooter = "\n]}}\n"
+
+// open creates the HAR file with the start of the document
+func (r *HARRecorder) open() error {
+	creator, err := json.Marshal(harCreator{Name: r.opts.CreatorName, Version: r.opts.CreatorVersion})
+	if err != nil {
+		return fmt.Errorf("error serializing HAR: %w", err)
+	}
+
+	header := fmt.Sprintf(`{"log":{"version":"1.2","creator":%s,"entries":[`, creator)
+
+	f, err := os.Create(r.path)
+	if err != nil {
+		return fmt.Errorf("error creating HAR file: %w", err)
+	}
+
+	if _, err := f.WriteString(header + harFooter); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing HAR file: %w", err)
+	}
+
+	r.file = f
+	r.offset = int64(len(header))
+
+	return nil
+}
+
+// append writes entry over the end of the document and writes it again
+// after the entry, so only the new entry is written for each exchange
+func (r *HARRecorder) append(entry harEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error serializing HAR entry: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return errors.New("HAR file already closed")
+	}
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if r.entries > 0 {
+		buf.WriteString(",")
+	}
+	buf.WriteString("\n")
+	buf.Write(content)
+	written := int64(buf.Len())
+	buf.WriteString(harFooter)
+
+	if _, err := r.file.WriteAt(buf.Bytes(), r.offset); err != nil {
+		return fmt.Errorf("error writing HAR file: %w", err)
+	}
+
+	r.offset += written
+	r.entries++
+
+	return nil
+}
+
+// Close closes the HAR file, the exchanges after it are not recorded. The
+// file is complete even if Close is not called.
+func (r *HARRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// Middleware returns a Middleware that records every exchange. Secrets are
+// masked with redactor.
+func (r *HARRecorder) Middleware(redactor *Redactor, log *logger.Logger) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			req, trace := withHARTrace(req)
+			reqBody := readReqBody(req)
+
+			res, err := next(req)
+
+			var resBody []byte
+			if err == nil && res.Body != nil && res.Body != http.NoBody {
+				resBody = peekResBody(res)
+			}
+
+			if err != nil {
+				res = nil
+			}
+
+			if errSave := r.record(redactor, req, reqBody, res, resBody, err, trace); errSave != nil {
+				log.Warnf("Could not save HAR file: %v", errSave)
+			}
+
+			return res, err
+		}
+	}
+}
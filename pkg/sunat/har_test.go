@@ -0,0 +1,166 @@
+package sunat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHARRecorderRedactsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "oauth2") {
+			fmt.Fprint(w, `{"access_token":"secret-token","expires_in":3600}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"codRespuesta":"0","arcCdr":"%s"}`, strings.Repeat("A", 200))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "sunat.har")
+	har := NewHARRecorder(path, HAROptions{CreatorVersion: "test", TruncatePayloads: true})
+	s := Sunat{HAR: har}
+	s.Tokens = NewPasswordTokenSource(s, server.URL, AuthParams{
+		ClientID:     "client",
+		ClientSecret: "client-secret-value",
+		Username:     "user",
+		Password:     "clave-sol-value",
+	})
+
+	if _, err := s.GetReceipt(context.Background(), server.URL, "ticket"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"client-secret-value", "clave-sol-value", "secret-token", strings.Repeat("A", 100)} {
+		if strings.Contains(string(content), secret) {
+			t.Fatalf("HAR file contains '%s'", secret)
+		}
+	}
+
+	var parsed harLog
+	if err := json.Unmarshal(content, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Log.Version != "1.2" {
+		t.Fatalf("expected HAR version 1.2, got %s", parsed.Log.Version)
+	}
+
+	if len(parsed.Log.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(parsed.Log.Entries))
+	}
+
+	auth := parsed.Log.Entries[1].Request.Headers
+	found := false
+	for _, h := range auth {
+		if h.Name == "Authorization" {
+			found = true
+			if h.Value != "Bearer ***" {
+				t.Fatalf("expected masked Authorization header, got '%s'", h.Value)
+			}
+		}
+	}
+
+	if !found {
+		t.Fatal("expected Authorization header in the HAR entry")
+	}
+}
+
+func TestHARRecorderAppendsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sunat.har")
+	har := NewHARRecorder(path, HAROptions{CreatorVersion: "test"})
+
+	var sizes []int64
+	for i := 0; i < 3; i++ {
+		entry := harEntry{Request: harRequest{Method: http.MethodPost, URL: fmt.Sprintf("https://sunat/%d", i)}}
+		if err := har.append(entry); err != nil {
+			t.Fatal(err)
+		}
+
+		// The file is a complete HAR after every exchange
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var parsed harLog
+		if err := json.Unmarshal(content, &parsed); err != nil {
+			t.Fatalf("invalid HAR after %d entries: %v\n%s", i+1, err, content)
+		}
+
+		if len(parsed.Log.Entries) != i+1 || parsed.Log.Entries[i].Request.URL != entry.Request.URL {
+			t.Fatalf("expected %d entries ending with %s, got %+v", i+1, entry.Request.URL, parsed.Log.Entries)
+		}
+
+		if parsed.Log.Creator.Version != "test" {
+			t.Fatalf("unexpected creator %+v", parsed.Log.Creator)
+		}
+
+		sizes = append(sizes, int64(len(content)))
+	}
+
+	// Only the new entry is written, the file grows by the same amount
+	if sizes[2]-sizes[1] != sizes[1]-sizes[0] {
+		t.Fatalf("expected the file to grow by one entry each time, got sizes %v", sizes)
+	}
+
+	if err := har.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := har.append(harEntry{}); err == nil {
+		t.Fatal("expected error recording after Close")
+	}
+}
+
+func TestHARRecorderSkipsLargeStreamedBody(t *testing.T) {
+	var received int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"numTicket":"123"}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "sunat.har")
+	har := NewHARRecorder(path, HAROptions{CreatorVersion: "test"})
+	s := Sunat{HAR: har, Tokens: NewStaticTokenSource("token"), MaxPayloadSize: 4 << 20}
+
+	params := SendReceiptParams{ReceiptFilePath: "20123456789-09-T001-1.xml", ZipFile: make([]byte, maxRecordedBodySize)}
+	if _, err := s.SendReceipt(context.Background(), server.URL, params); err != nil {
+		t.Fatal(err)
+	}
+
+	size := sendReceiptBody{fileName: "20123456789-09-T001-1.zip", zip: params.ZipFile}.size()
+	if received != size {
+		t.Fatalf("expected the server to receive %d bytes, got %d", size, received)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed harLog
+	if err := json.Unmarshal(content, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf("[streamed body of %d bytes not recorded]", size)
+	if got := parsed.Log.Entries[0].Request.PostData.Text; got != want {
+		t.Fatalf("expected '%s', got '%.100s'", want, got)
+	}
+}
@@ -0,0 +1,48 @@
+package sunat
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewHTTPClientCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caBundle, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	withoutCA, err := NewHTTPClient(DefaultHTTPOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := withoutCA.Get(server.URL); err == nil {
+		t.Fatal("expected untrusted certificate error")
+	}
+
+	opts := DefaultHTTPOptions
+	opts.CABundle = caBundle
+	withCA, err := NewHTTPClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := withCA.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	opts.ProxyURL = "not a url"
+	if _, err := NewHTTPClient(opts); err == nil {
+		t.Fatal("expected invalid proxy URL error")
+	}
+}
@@ -0,0 +1,105 @@
+package sunat
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrNotJWT = errors.New("token is not a JWT")
+
+// TokenClaims are the claims found in the tokens issued by SUNAT.
+// They are only decoded, the signature is not verified.
+type TokenClaims struct {
+	Issuer    string        `json:"iss"`
+	Subject   string        `json:"sub"`
+	Audience  any           `json:"aud"`
+	ExpiresAt int64         `json:"exp"`
+	IssuedAt  int64         `json:"iat"`
+	NotBefore int64         `json:"nbf"`
+	Scope     string        `json:"scope"`
+	UserData  TokenUserData `json:"userdata"`
+}
+
+type TokenUserData struct {
+	RUC        string `json:"numRUC"`
+	UserSOL    string `json:"usuarioSOL"`
+	Login      string `json:"login"`
+	FullName   string `json:"nombreCompleto"`
+	RegisterNo string `json:"nroRegistro"`
+}
+
+// Expiration returns the exp claim as a time, zero if not present
+func (c TokenClaims) Expiration() time.Time {
+	if c.ExpiresAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// IssuedAtTime returns the iat claim as a time, zero if not present
+func (c TokenClaims) IssuedAtTime() time.Time {
+	if c.IssuedAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(c.IssuedAt, 0)
+}
+
+// Scopes returns the APIs the token grants access to. SUNAT encodes them in
+// the aud claim as a JSON string with a list of {"api": ...} objects.
+func (c TokenClaims) Scopes() []string {
+	var scopes []string
+	if c.Scope != "" {
+		scopes = append(scopes, strings.Fields(c.Scope)...)
+	}
+
+	switch aud := c.Audience.(type) {
+	case string:
+		var apis []struct {
+			API string `json:"api"`
+		}
+
+		if err := json.Unmarshal([]byte(aud), &apis); err != nil {
+			return append(scopes, aud)
+		}
+
+		for _, a := range apis {
+			if a.API != "" {
+				scopes = append(scopes, a.API)
+			}
+		}
+	case []any:
+		for _, a := range aud {
+			if str, ok := a.(string); ok {
+				scopes = append(scopes, str)
+			}
+		}
+	}
+
+	return scopes
+}
+
+// ParseTokenClaims decodes the payload of a JWT access token
+func ParseTokenClaims(accessToken string) (TokenClaims, error) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return TokenClaims{}, ErrNotJWT
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return TokenClaims{}, fmt.Errorf("error decoding token payload: %w", err)
+	}
+
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return TokenClaims{}, fmt.Errorf("error parsing token claims: %w", err)
+	}
+
+	return claims, nil
+}
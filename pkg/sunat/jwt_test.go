@@ -0,0 +1,34 @@
+package sunat
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestParseTokenClaims(t *testing.T) {
+	payload := `{"iss":"https://api-seguridad.sunat.gob.pe/v1/clientessol/client/oauth2/token/","sub":"20123456789","aud":"[{\"api\":\"https://api-cpe.sunat.gob.pe\",\"recursos\":[{\"id\":\"/v1/contribuyente/gem\"}]}]","exp":1700003600,"iat":1700000000,"userdata":{"numRUC":"20123456789","usuarioSOL":"MODDATOS"}}`
+	accessToken := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+
+	claims, err := ParseTokenClaims(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.UserData.RUC != "20123456789" || claims.UserData.UserSOL != "MODDATOS" {
+		t.Fatalf("unexpected user data %+v", claims.UserData)
+	}
+
+	if claims.Expiration().Unix() != 1700003600 {
+		t.Fatalf("unexpected expiration %v", claims.Expiration())
+	}
+
+	expected := []string{"https://api-cpe.sunat.gob.pe"}
+	if !reflect.DeepEqual(claims.Scopes(), expected) {
+		t.Fatalf("expected scopes %v, got %v", expected, claims.Scopes())
+	}
+
+	if _, err := ParseTokenClaims("opaque-token"); err != ErrNotJWT {
+		t.Fatalf("expected ErrNotJWT, got %v", err)
+	}
+}
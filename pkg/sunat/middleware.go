@@ -0,0 +1,42 @@
+package sunat
+
+import "net/http"
+
+// RoundTripFunc sends a request and returns its response
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps the sending of every request to SUNAT, e.g. to add
+// headers, collect metrics or write audit records. It must call next to
+// continue with the request.
+//
+//	func Correlation(next sunat.RoundTripFunc) sunat.RoundTripFunc {
+//		return func(req *http.Request) (*http.Response, error) {
+//			req.Header.Set("X-Correlation-ID", newID())
+//			return next(req)
+//		}
+//	}
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// roundTrip returns the chain that sends a single request: the middlewares
+// in s.Middlewares (the first one is the outermost), then logging and HAR
+// recording, and finally the HTTP client
+func (s Sunat) roundTrip() RoundTripFunc {
+	next := RoundTripFunc(s.httpClient().Do)
+
+	if s.HAR != nil {
+		next = s.HAR.Middleware(s.redactor(), s.log())(next)
+	}
+
+	next = LoggingMiddleware(s.log(), s.redactor())(next)
+
+	for i := len(s.Middlewares) - 1; i >= 0; i-- {
+		next = s.Middlewares[i](next)
+	}
+
+	return next
+}
+
+// doSingleRequest sends req once through the middleware chain
+func (s Sunat) doSingleRequest(req *http.Request) (*http.Response, error) {
+	return s.roundTrip()(req)
+}
@@ -0,0 +1,56 @@
+package sunat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMiddlewares(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Correlation-ID") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"codRespuesta":"0"}`)
+	}))
+	defer server.Close()
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" before")
+				res, err := next(req)
+				calls = append(calls, name+" after")
+				return res, err
+			}
+		}
+	}
+
+	correlation := func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Correlation-ID", "abc")
+			return next(req)
+		}
+	}
+
+	s := Sunat{
+		Tokens:      NewStaticTokenSource("token"),
+		Middlewares: []Middleware{trace("outer"), trace("inner"), correlation},
+	}
+
+	if _, err := s.GetReceipt(context.Background(), server.URL, "ticket"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"outer before", "inner before", "inner after", "outer after"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected %v, got %v", expected, calls)
+	}
+}
@@ -0,0 +1,210 @@
+package sunat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/haguirrear/sunatapi/pkg/filelock"
+	"golang.org/x/time/rate"
+)
+
+// EndpointClass groups the SUNAT endpoints that share a rate limit
+type EndpointClass int
+
+const (
+	// Token requests to api-seguridad
+	EndpointAuth EndpointClass = iota
+	// Sending receipts
+	EndpointSend
+	// Querying tickets
+	EndpointQuery
+)
+
+func (c EndpointClass) String() string {
+	switch c {
+	case EndpointAuth:
+		return "auth"
+	case EndpointSend:
+		return "send"
+	case EndpointQuery:
+		return "query"
+	default:
+		return "unknown"
+	}
+}
+
+// RateLimit is the number of requests per second allowed for an endpoint
+// class, and how many can be sent at once. Zero means no limit.
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// RateLimiter is a token bucket per endpoint class. A single RateLimiter can
+// be shared by all the Sunat clients of a process and is safe for concurrent
+// use. The buckets of a limiter built with NewSharedRateLimiter are kept on
+// disk, so they are also shared with the other processes using the same
+// folder.
+type RateLimiter struct {
+	limiters map[EndpointClass]*rate.Limiter
+	// Folder of the shared buckets, empty if they are kept in memory
+	dir    string
+	limits map[EndpointClass]RateLimit
+}
+
+// NewRateLimiter builds a RateLimiter. Classes without a limit are not
+// throttled.
+func NewRateLimiter(limits map[EndpointClass]RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		limiters: make(map[EndpointClass]*rate.Limiter),
+		limits:   make(map[EndpointClass]RateLimit),
+	}
+
+	for class, limit := range limits {
+		if limit.RequestsPerSecond <= 0 {
+			continue
+		}
+
+		if limit.Burst < 1 {
+			limit.Burst = int(math.Max(1, math.Ceil(limit.RequestsPerSecond)))
+		}
+
+		l.limits[class] = limit
+		l.limiters[class] = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), limit.Burst)
+	}
+
+	return l
+}
+
+// NewSharedRateLimiter builds a RateLimiter whose buckets are kept in dir,
+// so the limits apply to all the processes using it, e.g. several batches
+// running at the same time
+func NewSharedRateLimiter(dir string, limits map[EndpointClass]RateLimit) *RateLimiter {
+	l := NewRateLimiter(limits)
+	l.dir = dir
+
+	return l
+}
+
+// DefaultRateLimitDir returns the folder used to share the rate limits
+// inside the user cache directory (e.g. ~/.cache/sunatapi/ratelimit)
+func DefaultRateLimitDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding user cache folder: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "sunatapi", "ratelimit"), nil
+}
+
+// Wait blocks until a request to class is allowed or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context, class EndpointClass) error {
+	if l == nil {
+		return nil
+	}
+
+	var err error
+	if l.dir != "" {
+		limit, ok := l.limits[class]
+		if !ok {
+			return nil
+		}
+
+		err = l.waitShared(ctx, class, limit)
+	} else {
+		limiter, ok := l.limiters[class]
+		if !ok {
+			return nil
+		}
+
+		err = limiter.Wait(ctx)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error waiting for %s rate limit: %w", class, err)
+	}
+
+	return nil
+}
+
+// bucketState is the content of the file of a shared bucket
+type bucketState struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// waitShared takes a token from the bucket of class in l.dir, waiting
+// until there is one
+func (l *RateLimiter) waitShared(ctx context.Context, class EndpointClass, limit RateLimit) error {
+	for {
+		wait, err := l.takeShared(ctx, class, limit)
+		if err != nil || wait == 0 {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// takeShared takes a token from the bucket of class if there is one,
+// otherwise returns how long to wait for the next one
+func (l *RateLimiter) takeShared(ctx context.Context, class EndpointClass, limit RateLimit) (time.Duration, error) {
+	path := filepath.Join(l.dir, class.String()+".json")
+
+	lock, err := filelock.Acquire(ctx, path+lockFileExt)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Release()
+
+	now := time.Now()
+	burst := float64(limit.Burst)
+
+	// A missing or corrupted bucket starts full
+	state := bucketState{Tokens: burst, Updated: now}
+	if content, err := os.ReadFile(path); err == nil {
+		var saved bucketState
+		if json.Unmarshal(content, &saved) == nil {
+			state = saved
+		}
+	}
+
+	// The clock may go backwards
+	if elapsed := now.Sub(state.Updated); elapsed > 0 {
+		state.Tokens = math.Min(burst, state.Tokens+elapsed.Seconds()*limit.RequestsPerSecond)
+	}
+	state.Updated = now
+
+	var wait time.Duration
+	if state.Tokens >= 1 {
+		state.Tokens--
+	} else {
+		wait = time.Duration((1 - state.Tokens) / limit.RequestsPerSecond * float64(time.Second))
+		// Zero means the token was taken
+		if wait < time.Millisecond {
+			wait = time.Millisecond
+		}
+	}
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return 0, fmt.Errorf("error serializing rate limit: %w", err)
+	}
+
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		return 0, fmt.Errorf("error saving rate limit: %w", err)
+	}
+
+	return wait, nil
+}
@@ -0,0 +1,71 @@
+package sunat
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRespectsContext(t *testing.T) {
+	l := NewRateLimiter(map[EndpointClass]RateLimit{
+		EndpointSend: {RequestsPerSecond: 0.1, Burst: 1},
+	})
+
+	if err := l.Wait(context.Background(), EndpointSend); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx, EndpointSend); err == nil {
+		t.Fatal("expected error waiting for the second request")
+	}
+
+	// Classes without a limit are not throttled
+	for i := 0; i < 10; i++ {
+		if err := l.Wait(context.Background(), EndpointQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Wait(context.Background(), EndpointAuth); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	dir := t.TempDir()
+	limits := map[EndpointClass]RateLimit{
+		EndpointSend: {RequestsPerSecond: 10, Burst: 1},
+	}
+
+	// Two processes using the same folder
+	a := NewSharedRateLimiter(dir, limits)
+	b := NewSharedRateLimiter(dir, limits)
+
+	start := time.Now()
+	for _, l := range []*RateLimiter{a, b, a} {
+		if err := l.Wait(context.Background(), EndpointSend); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first request uses the burst, the other two wait 100ms each
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Fatalf("expected the limit to be shared, 3 requests took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := b.Wait(ctx, EndpointSend); err == nil {
+		t.Fatal("expected error waiting past the context deadline")
+	}
+
+	// Classes without a limit are not throttled
+	if err := a.Wait(context.Background(), EndpointQuery); err != nil {
+		t.Fatal(err)
+	}
+}
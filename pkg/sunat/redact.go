@@ -0,0 +1,232 @@
+package sunat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const redactedValue = "***"
+
+// Redactor masks credentials and tokens in the requests and responses
+// before they are logged or recorded
+type Redactor struct {
+	// Form fields sent to the auth endpoint that contain credentials
+	FormFields []string
+	// JSON keys that contain credentials or tokens
+	JSONKeys []string
+	// Headers that contain credentials or tokens
+	Headers []string
+	// URL path segments followed by a credential, e.g. the client_id in
+	// /v1/clientessol/{client_id}/oauth2/token/
+	PathSegments []string
+	// Disabled shows the secrets as they are. Only meant for local debugging.
+	Disabled bool
+}
+
+var DefaultRedactor = &Redactor{
+	FormFields:   []string{"password", "client_secret", "client_id", "username"},
+	JSONKeys:     []string{"access_token", "refresh_token", "password", "client_secret"},
+	Headers:      []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+	PathSegments: []string{"clientessol", "clientesextranet"},
+}
+
+// NewRedactor returns a Redactor that masks the default fields plus the
+// extra ones, which are treated as form fields, JSON keys and headers
+func NewRedactor(extra ...string) *Redactor {
+	r := &Redactor{
+		FormFields: append([]string{}, DefaultRedactor.FormFields...),
+		JSONKeys:   append([]string{}, DefaultRedactor.JSONKeys...),
+		Headers:    append([]string{}, DefaultRedactor.Headers...),
+		// Extra fields are not looked for in the URL
+		PathSegments: append([]string{}, DefaultRedactor.PathSegments...),
+	}
+
+	for _, e := range extra {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+
+		r.FormFields = append(r.FormFields, e)
+		r.JSONKeys = append(r.JSONKeys, e)
+		r.Headers = append(r.Headers, e)
+	}
+
+	return r
+}
+
+// enabled returns a copy of r that always masks secrets, for outputs like
+// HAR files that are meant to be shared
+func (r *Redactor) enabled() *Redactor {
+	if !r.Disabled {
+		return r
+	}
+
+	copy := *r
+	copy.Disabled = false
+
+	return &copy
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Header masks the value of sensitive headers, keeping the auth scheme
+// (e.g. "Bearer ***") so the kind of credential is still visible
+func (r *Redactor) Header(name, value string) string {
+	if r.Disabled || !containsFold(r.Headers, name) {
+		return value
+	}
+
+	if scheme, _, found := strings.Cut(value, " "); found && (strings.EqualFold(name, "Authorization") || strings.EqualFold(name, "Proxy-Authorization")) {
+		return scheme + " " + redactedValue
+	}
+
+	return redactedValue
+}
+
+// URL returns u with the credentials in its path masked
+func (r *Redactor) URL(u *url.URL) string {
+	if r.Disabled {
+		return u.String()
+	}
+
+	segments := strings.Split(u.EscapedPath(), "/")
+	changed := false
+	for i := 0; i < len(segments)-1; i++ {
+		if containsFold(r.PathSegments, segments[i]) {
+			segments[i+1] = redactedValue
+			changed = true
+		}
+	}
+
+	if !changed {
+		return u.String()
+	}
+
+	redacted := *u
+	redacted.RawPath = strings.Join(segments, "/")
+	if path, err := url.PathUnescape(redacted.RawPath); err == nil {
+		redacted.Path = path
+	}
+
+	return redacted.String()
+}
+
+// HeaderMap returns a copy of h with the sensitive headers masked
+func (r *Redactor) HeaderMap(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			redacted.Add(name, r.Header(name, v))
+		}
+	}
+
+	return redacted
+}
+
+// Body masks sensitive fields of form and JSON bodies. Other bodies are
+// returned as they are.
+func (r *Redactor) Body(contentType string, body []byte) []byte {
+	if r.Disabled {
+		return body
+	}
+
+	switch {
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		return r.form(body)
+	case strings.Contains(contentType, "json"):
+		return r.json(body)
+	default:
+		return body
+	}
+}
+
+func (r *Redactor) form(body []byte) []byte {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return body
+	}
+
+	changed := false
+	for key := range form {
+		if containsFold(r.FormFields, key) {
+			form.Set(key, redactedValue)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return body
+	}
+
+	return []byte(form.Encode())
+}
+
+func (r *Redactor) json(body []byte) []byte {
+	var parsed any
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return body
+	}
+
+	if !r.jsonValue(parsed) {
+		return body
+	}
+
+	redacted, err := json.Marshal(parsed)
+	if err != nil {
+		return body
+	}
+
+	return redacted
+}
+
+// jsonValue masks sensitive keys in place and reports if any was found
+func (r *Redactor) jsonValue(v any) bool {
+	changed := false
+
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if containsFold(r.JSONKeys, key) {
+				v[key] = redactedValue
+				changed = true
+				continue
+			}
+
+			changed = r.jsonValue(value) || changed
+		}
+	case []any:
+		for _, value := range v {
+			changed = r.jsonValue(value) || changed
+		}
+	}
+
+	return changed
+}
+
+// RedactHeader masks the value of a sensitive header with DefaultRedactor
+func RedactHeader(name, value string) string {
+	return DefaultRedactor.Header(name, value)
+}
+
+// RedactBody masks the sensitive fields of a body with DefaultRedactor
+func RedactBody(contentType string, body []byte) []byte {
+	return DefaultRedactor.Body(contentType, body)
+}
+
+func (s Sunat) redactor() *Redactor {
+	if s.Redactor == nil {
+		return DefaultRedactor
+	}
+
+	return s.Redactor
+}
@@ -0,0 +1,79 @@
+package sunat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/haguirrear/sunatapi/pkg/logger"
+)
+
+func TestTraceLogsRedactSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"token-value","expires_in":3600,"custom_secret":"custom-value"}`)
+	}))
+	defer server.Close()
+
+	params := AuthParams{ClientID: "client", ClientSecret: "secret-value", Username: "user", Password: "password-value"}
+	secrets := []string{"secret-value", "password-value", "token-value", "custom-value"}
+
+	var logs bytes.Buffer
+	s := Sunat{Logger: logger.NewLogger(&logs, logger.TraceLevel), Redactor: NewRedactor("custom_secret")}
+	if _, err := s.GetToken(context.Background(), server.URL, params); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range secrets {
+		if strings.Contains(logs.String(), secret) {
+			t.Fatalf("logs contain '%s':\n%s", secret, logs.String())
+		}
+	}
+
+	logs.Reset()
+	s.Redactor.Disabled = true
+	if _, err := s.GetToken(context.Background(), server.URL, params); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(logs.String(), "password-value") {
+		t.Fatal("expected secrets in the logs with the redactor disabled")
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	if got := RedactHeader("Authorization", "Bearer abc"); got != "Bearer ***" {
+		t.Fatalf("expected 'Bearer ***', got '%s'", got)
+	}
+
+	if got := RedactHeader("Content-Type", "application/json"); got != "application/json" {
+		t.Fatalf("expected header unchanged, got '%s'", got)
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://api-seguridad.sunat.gob.pe/v1/clientessol/client-id/oauth2/token/", "https://api-seguridad.sunat.gob.pe/v1/clientessol/***/oauth2/token/"},
+		{"https://api-seguridad.sunat.gob.pe/v1/clientesextranet/client-id/oauth2/token/", "https://api-seguridad.sunat.gob.pe/v1/clientesextranet/***/oauth2/token/"},
+		{"https://api-cpe.sunat.gob.pe/v1/contribuyente/gem/comprobantes/envios/123", "https://api-cpe.sunat.gob.pe/v1/contribuyente/gem/comprobantes/envios/123"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := DefaultRedactor.URL(u); got != tt.expected {
+			t.Fatalf("expected '%s', got '%s'", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package sunat_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+	"github.com/haguirrear/sunatapi/pkg/sunat/sunattest"
+)
+
+const (
+	authURL = "https://api-seguridad.sunat.gob.pe"
+	baseURL = "https://api-cpe.sunat.gob.pe"
+)
+
+func TestSendAndPollReceiptReplay(t *testing.T) {
+	rec, err := sunattest.New("testdata/gre.json", sunattest.ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The recorded receipt is not signed
+	s := sunat.Sunat{HTTPClient: rec.Client(), SkipSignatureCheck: true}
+	s.Tokens = sunat.NewPasswordTokenSource(s, authURL, sunat.AuthParams{
+		ClientID:     "test-client-id",
+		ClientSecret: "any-secret",
+		Username:     "20123456789MODDATOS",
+		Password:     "any-password",
+	})
+
+	receiptPath := "testdata/20123456789-09-T001-1.xml"
+	f, err := os.Open(receiptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ticket, err := s.ZipAndSendReceipt(context.Background(), baseURL, receiptPath, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ticket != "a1b2c3d4-0000-4000-8000-000000000001" {
+		t.Fatalf("unexpected ticket '%s'", ticket)
+	}
+
+	receipt, err := s.PollReceipt(context.Background(), baseURL, ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !receipt.IsSuccess() || receipt.ReceiptCertificate == "" {
+		t.Fatalf("expected successful receipt with CDR, got %+v", receipt)
+	}
+
+	if unused := rec.Unused(); len(unused) > 0 {
+		t.Fatalf("expected all interactions to be replayed, %d unused", len(unused))
+	}
+}
+
+func TestSendLogPreventsDuplicateSendReplay(t *testing.T) {
+	rec, err := sunattest.New("testdata/gre.json", sunattest.ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendLog := sunat.NewSendLog(t.TempDir())
+	s := sunat.Sunat{HTTPClient: rec.Client(), SkipSignatureCheck: true, SendLog: &sendLog}
+	s.Tokens = sunat.NewPasswordTokenSource(s, authURL, sunat.AuthParams{
+		ClientID:     "test-client-id",
+		ClientSecret: "any-secret",
+		Username:     "20123456789MODDATOS",
+		Password:     "any-password",
+	})
+
+	receiptPath := "testdata/20123456789-09-T001-1.xml"
+	content, err := os.ReadFile(receiptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err := s.ZipAndSendReceipt(context.Background(), baseURL, receiptPath, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.PollReceipt(context.Background(), baseURL, ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	record, ok, err := sendLog.Get("20123456789-09-T001-1")
+	if err != nil || !ok {
+		t.Fatalf("expected send record, got ok=%v err=%v", ok, err)
+	}
+
+	if record.Status != sunat.SendStatusAccepted || record.Ticket != ticket {
+		t.Fatalf("expected accepted record with ticket %s, got %+v", ticket, record)
+	}
+
+	// The cassette has a single send, a second one would fail to replay
+	_, err = s.ZipAndSendReceipt(context.Background(), baseURL, receiptPath, bytes.NewReader(content))
+
+	var alreadySent *sunat.AlreadySentError
+	if !errors.As(err, &alreadySent) {
+		t.Fatalf("expected AlreadySentError, got %v", err)
+	}
+
+	if !alreadySent.SameContent || alreadySent.Record.Ticket != ticket {
+		t.Fatalf("unexpected error %+v", alreadySent)
+	}
+}
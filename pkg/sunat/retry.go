@@ -0,0 +1,209 @@
+package sunat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy defines how failed requests are retried. The delay between
+// attempts grows exponentially from BaseDelay up to MaxDelay, and is
+// randomized by Jitter (a fraction between 0 and 1) to avoid several clients
+// retrying at the same time.
+type RetryPolicy struct {
+	// Total number of attempts, including the first one. Zero or one means
+	// the request is not retried.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Jitter:      0.2,
+}
+
+// endpoint describes how requests to a SUNAT endpoint are throttled and
+// retried
+type endpoint struct {
+	class EndpointClass
+	retry retryMode
+}
+
+var (
+	// Requesting a token has no side effects, so it is always safe to retry
+	authEndpoint  = endpoint{class: EndpointAuth, retry: retryIdempotent}
+	sendEndpoint  = endpoint{class: EndpointSend, retry: retryUnsent}
+	queryEndpoint = endpoint{class: EndpointQuery, retry: retryIdempotent}
+)
+
+// retryMode tells which failures are safe to retry for a request
+type retryMode int
+
+const (
+	// The request has no side effects, it can be retried on any transient
+	// failure (network errors, 429 and 5xx responses)
+	retryIdempotent retryMode = iota
+	// The request must be retried only if it provably never reached SUNAT,
+	// otherwise it could be processed twice
+	retryUnsent
+)
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// delay returns how long to wait after the given failed attempt (starting
+// at 1). retryAfter is the delay requested by the server, if any.
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.Jitter > 0 {
+		d = d * (1 - p.Jitter + rand.Float64()*2*p.Jitter)
+	}
+
+	delay := time.Duration(d)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay
+}
+
+// shouldRetry reports whether the result of an attempt can be retried
+func shouldRetry(mode retryMode, res *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+
+		if isConnectionError(err) {
+			return true
+		}
+
+		return mode == retryIdempotent && isTransientError(err)
+	}
+
+	if mode != retryIdempotent {
+		return false
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConnectionError reports whether err happened before the connection was
+// established, so the request was never sent
+func isConnectionError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isTransientError reports whether err is a network failure that may not
+// happen again, like a timeout or a connection reset
+func isTransientError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseRetryAfter reads the Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(res *http.Response) time.Duration {
+	if res == nil {
+		return 0
+	}
+
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// doRequest sends req, retrying it according to s.Retry when the failure
+// is safe to retry for the endpoint. Every attempt waits for the rate limit
+// of the endpoint class.
+func (s Sunat) doRequest(req *http.Request, e endpoint) (*http.Response, error) {
+	attempts := s.Retry.attempts()
+
+	for attempt := 1; ; attempt++ {
+		if err := s.Limiter.Wait(req.Context(), e.class); err != nil {
+			return nil, err
+		}
+
+		res, err := s.doSingleRequest(req)
+
+		if attempt >= attempts || !shouldRetry(e.retry, res, err) {
+			return res, err
+		}
+
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			// The body was already consumed and cannot be sent again
+			return res, err
+		}
+
+		delay := s.Retry.delay(attempt, parseRetryAfter(res))
+		if err != nil {
+			s.log().Debugf("Attempt %d/%d failed: %v, retrying in %s", attempt, attempts, err, delay)
+		} else {
+			s.log().Debugf("Attempt %d/%d failed: %s, retrying in %s", attempt, attempts, res.Status, delay)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, fmt.Errorf("request cancelled while waiting to retry: %w", req.Context().Err())
+		case <-timer.C:
+		}
+
+		next := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error rebuilding request body to retry: %w", err)
+			}
+			next.Body = body
+		}
+		req = next
+	}
+}
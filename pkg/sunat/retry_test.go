@@ -0,0 +1,78 @@
+package sunat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestRetryTransientResponses(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"codRespuesta":"0"}`)
+	}))
+	defer server.Close()
+
+	s := Sunat{Tokens: NewStaticTokenSource("token"), Retry: testRetryPolicy}
+
+	receipt, err := s.GetReceipt(context.Background(), server.URL, "ticket")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !receipt.IsSuccess() {
+		t.Fatalf("expected successful receipt, got code '%s'", receipt.ResponseCode)
+	}
+
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestSendReceiptIsNotRetriedAfterReachingServer(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	s := Sunat{Tokens: NewStaticTokenSource("token"), Retry: testRetryPolicy}
+
+	_, err := s.SendReceipt(context.Background(), server.URL, SendReceiptParams{ReceiptFilePath: "20123456789-09-T001-1.xml"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", calls)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, e := range expected {
+		if d := p.delay(i+1, 0); d != e {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, e, d)
+		}
+	}
+
+	if d := p.delay(1, 500*time.Millisecond); d != 500*time.Millisecond {
+		t.Fatalf("expected Retry-After to be honored, got %s", d)
+	}
+}
@@ -14,88 +14,212 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat/firma"
 )
 
 var ErrorFileNotFound = errors.New("File not found")
 
-func (s Sunat) ZipAndSendReceipt(baseURL, authToken, receiptPath string, receiptFile io.Reader) (numTicket string, err error) {
-	zipFile, err := s.createSingleFileZip(receiptPath, receiptFile)
+var ErrPayloadTooLarge = errors.New("receipt is too large")
+
+// DefaultMaxPayloadSize is the largest body of a send receipt request, the
+// zip in base64 plus its hash and name. Bigger receipts are refused before
+// uploading them. It is not a limit published by SUNAT, which does not
+// document one for this endpoint, but a safeguard of this client against
+// uploading a huge file by mistake. Change it with Sunat.MaxPayloadSize.
+const DefaultMaxPayloadSize = 10 << 20
+
+// ZipAndSendReceipt sends the XML in receiptFile. The name of receiptPath
+// must follow SUNAT's naming rules and match the content of the XML, see
+// ReceiptDocumentID. Its signature is verified before sending, unless
+// s.SkipSignatureCheck is set. When s.SendLog is set, a receipt already
+// sent returns an *AlreadySentError instead of sending it again, unless
+// s.ForceSend is set.
+func (s Sunat) ZipAndSendReceipt(ctx context.Context, baseURL, receiptPath string, receiptFile io.Reader) (numTicket string, err error) {
+	content, err := io.ReadAll(receiptFile)
 	if err != nil {
-		return "", fmt.Errorf("error sending receipt %s: %w", receiptPath, err)
+		return "", fmt.Errorf("error reading receipt %s: %w", receiptPath, err)
 	}
 
-	zipFileReader := bytes.NewReader(zipFile.Bytes())
-
-	zipHash, err := HashFileContent(zipFileReader)
+	docID, err := ReceiptDocumentID(receiptPath, bytes.NewReader(content))
 	if err != nil {
-		return "", fmt.Errorf("error sendig receipt %s: %w", receiptPath, err)
+		return "", fmt.Errorf("error sending receipt %s: %w", receiptPath, err)
 	}
 
-	zipFileReader.Seek(0, io.SeekStart)
+	if !s.SkipSignatureCheck {
+		s.log().Debug("Verifying signature...")
+		if _, err := firma.Verify(content, firma.VerifyOptions{RUC: docID.RUC}); err != nil {
+			return "", fmt.Errorf("error sending receipt %s: signature check failed: %w", receiptPath, err)
+		}
+	}
 
-	zipBase64, err := EncodeFileBase64(zipFileReader)
+	// The zip is built once, its hash and base64 encoding are computed
+	// while the request body is sent
+	zipFile, err := s.createSingleFileZip(docID.XMLFileName(), bytes.NewReader(content))
 	if err != nil {
 		return "", fmt.Errorf("error sending receipt %s: %w", receiptPath, err)
 	}
 
 	params := SendReceiptParams{
-		ReceiptFilePath:    receiptPath,
-		ZipFileHash:        zipHash,
-		ZipFileBase64:      zipBase64,
-		AuthorizationToken: authToken,
+		ReceiptFilePath: receiptPath,
+		DocumentID:      docID,
+		ZipFile:         zipFile.Bytes(),
+	}
+
+	if s.SendLog == nil {
+		s.log().Debug("Sending receipt...")
+		res, err := s.SendReceipt(ctx, baseURL, params)
+		if err != nil {
+			return "", err
+		}
+
+		return res.NumTicket, nil
+	}
+
+	return s.sendOnce(ctx, baseURL, params, ContentHash(content))
+}
+
+// sendOnce sends the receipt recording it in s.SendLog. The record is
+// saved before sending, so if the process stops before obtaining the
+// ticket the next send reports ErrInterruptedSend.
+func (s Sunat) sendOnce(ctx context.Context, baseURL string, params SendReceiptParams, hash string) (string, error) {
+	document := params.DocumentID.String()
+
+	lock, err := s.SendLog.Lock(ctx, document)
+	if err != nil {
+		return "", fmt.Errorf("error sending receipt %s: %w", params.ReceiptFilePath, err)
+	}
+	defer lock.Release()
+
+	if !s.ForceSend {
+		if err := s.SendLog.check(document, hash); err != nil {
+			return "", fmt.Errorf("error sending receipt %s: %w", params.ReceiptFilePath, err)
+		}
 	}
 
-	s.Logger.Debug("Sending receipt...")
-	res, err := s.SendReceipt(baseURL, params)
+	record := SentReceipt{Document: document, SHA256: hash, Status: SendStatusSending, SentAt: time.Now()}
+	if err := s.SendLog.Put(record); err != nil {
+		return "", fmt.Errorf("error sending receipt %s: %w", params.ReceiptFilePath, err)
+	}
+
+	s.log().Debug("Sending receipt...")
+	res, err := s.SendReceipt(ctx, baseURL, params)
 	if err != nil {
+		// Only when it is certain that SUNAT did not keep the receipt it can
+		// be sent again. After a timeout or a connection reset SUNAT may have
+		// received it, the record stays as sending so the next send reports
+		// ErrInterruptedSend.
+		if notReceived(err) {
+			if errDelete := s.SendLog.Delete(document); errDelete != nil {
+				s.log().Warnf("Could not update send record: %v", errDelete)
+			}
+		}
 		return "", err
 	}
 
-	return res.NumTicket, err
+	record.Ticket = res.NumTicket
+	record.Status = SendStatusSent
+	if err := s.SendLog.PutTicket(record.Ticket, document); err != nil {
+		s.log().Warnf("Could not update send record: %v", err)
+	}
+	if err := s.SendLog.Put(record); err != nil {
+		s.log().Warnf("Could not update send record: %v", err)
+	}
+
+	return res.NumTicket, nil
+}
+
+// notReceived reports whether err proves that SUNAT did not keep the
+// receipt: it answered with an error, the connection was never made or the
+// receipt was refused before sending it
+func notReceived(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) || isConnectionError(err) || errors.Is(err, ErrPayloadTooLarge)
 }
 
 type SendReceiptParams struct {
-	ReceiptFilePath    string
-	ZipFileBase64      string
-	ZipFileHash        string
+	ReceiptFilePath string
+	// Parsed from ReceiptFilePath if empty
+	DocumentID DocumentID
+	// Zip file with the XML of the receipt
+	ZipFile []byte
+
+	// Deprecated: use ZipFile. The zip in base64, used when ZipFile is empty.
+	ZipFileBase64 string
+	// Deprecated: the hash is computed from the zip. When set it must match it.
+	ZipFileHash string
+	// Deprecated: use Sunat.Tokens. Used as a static token when it is nil.
 	AuthorizationToken string
 }
 
+// zipFile returns the zip of the receipt, from ZipFile or the deprecated
+// ZipFileBase64
+func (p SendReceiptParams) zipFile() ([]byte, error) {
+	zipFile := p.ZipFile
+	if len(zipFile) == 0 && p.ZipFileBase64 != "" {
+		var err error
+		if zipFile, err = base64.StdEncoding.DecodeString(p.ZipFileBase64); err != nil {
+			return nil, fmt.Errorf("error decoding ZipFileBase64: %w", err)
+		}
+	}
+
+	if p.ZipFileHash != "" {
+		sum := sha256.Sum256(zipFile)
+		if !strings.EqualFold(p.ZipFileHash, hex.EncodeToString(sum[:])) {
+			return nil, errors.New("ZipFileHash does not match the zip file")
+		}
+	}
+
+	return zipFile, nil
+}
+
 type SendReceiptResponse struct {
 	NumTicket string `json:"numTicket"`
 }
 
-func (s Sunat) SendReceipt(baseURL string, params SendReceiptParams) (SendReceiptResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+func (s Sunat) SendReceipt(ctx context.Context, baseURL string, params SendReceiptParams) (SendReceiptResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
 	defer cancel()
 
-	filename := filepath.Base(params.ReceiptFilePath)
-	fileWithoutExt := strings.Split(filename, ".")[0]
-	payloadMap := map[string]any{
-		"archivo": map[string]any{
-			"nomArchivo": fileWithoutExt + ".zip",
-			"arcGreZip":  params.ZipFileBase64,
-			"hashZip":    params.ZipFileHash,
-		},
+	docID := params.DocumentID
+	if docID == (DocumentID{}) {
+		var err error
+		docID, err = ParseDocumentID(params.ReceiptFilePath)
+		if err != nil {
+			return SendReceiptResponse{}, fmt.Errorf("error sending receipt %s: %w", params.ReceiptFilePath, err)
+		}
 	}
 
-	payload, err := json.Marshal(payloadMap)
+	zipFile, err := params.zipFile()
 	if err != nil {
-		return SendReceiptResponse{}, fmt.Errorf("error building send receipt payload: %w", err)
+		return SendReceiptResponse{}, fmt.Errorf("error sending receipt %s: %w", params.ReceiptFilePath, err)
+	}
+
+	if s.Tokens == nil && params.AuthorizationToken != "" {
+		s.Tokens = NewStaticTokenSource(params.AuthorizationToken)
+	}
+
+	payload := sendReceiptBody{fileName: docID.ZipFileName(), zip: zipFile}
+	if size, max := payload.size(), s.maxPayloadSize(); max > 0 && size > max {
+		return SendReceiptResponse{}, fmt.Errorf("error sending receipt %s: %w: %d bytes, the maximum is %d", params.ReceiptFilePath, ErrPayloadTooLarge, size, max)
 	}
 
-	reqURL := fmt.Sprintf("%s/v1/contribuyente/gem/comprobantes/%s", baseURL, fileWithoutExt)
+	reqURL := fmt.Sprintf("%s/v1/contribuyente/gem/comprobantes/%s", baseURL, docID)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, nil)
 	if err != nil {
 		return SendReceiptResponse{}, fmt.Errorf("error building request for send receipt: %w", err)
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", params.AuthorizationToken))
+	// Each attempt (retries and 401 replay) streams the body again
+	req.Body = payload.open()
+	req.GetBody = func() (io.ReadCloser, error) { return payload.open(), nil }
+	req.ContentLength = payload.size()
 	req.Header.Add("Content-Type", "application/json")
 
-	// res, err := client.Do(req)
-	res, err := s.doRequest(client, req)
+	res, err := s.doAuthorizedRequest(req, sendEndpoint)
 	if err != nil {
 		return SendReceiptResponse{}, fmt.Errorf("error sending receipt %s: %w", params.ReceiptFilePath, err)
 	}
@@ -108,7 +232,7 @@ func (s Sunat) SendReceipt(baseURL string, params SendReceiptParams) (SendReceip
 	}
 
 	if res.StatusCode >= 400 {
-		return SendReceiptResponse{}, fmt.Errorf("error sending receipt %s: %s | %s", params.ReceiptFilePath, res.Status, string(body))
+		return SendReceiptResponse{}, fmt.Errorf("error sending receipt %s: %w", params.ReceiptFilePath, newAPIError(res, body))
 	}
 
 	var bodyParsed SendReceiptResponse
@@ -120,6 +244,8 @@ func (s Sunat) SendReceipt(baseURL string, params SendReceiptParams) (SendReceip
 }
 
 // Encodes the content of a file in base64
+//
+// Deprecated: SendReceipt encodes SendReceiptParams.ZipFile while sending it.
 func EncodeFileBase64(file io.Reader) (string, error) {
 	bContent, err := io.ReadAll(file)
 	if err != nil {
@@ -130,6 +256,8 @@ func EncodeFileBase64(file io.Reader) (string, error) {
 }
 
 // Hashes the content of a file with SHA-256
+//
+// Deprecated: SendReceipt hashes SendReceiptParams.ZipFile while sending it.
 func HashFileContent(file io.Reader) (string, error) {
 	h := sha256.New()
 	if _, err := io.Copy(h, file); err != nil {
@@ -139,7 +267,103 @@ func HashFileContent(file io.Reader) (string, error) {
 	checkSum := h.Sum(nil)
 
 	return hex.EncodeToString(checkSum), nil
+}
+
+// sendReceiptBody is the JSON body of the send receipt request:
+//
+//	{"archivo":{"arcGreZip":"<zip in base64>","hashZip":"<sha256 of the zip>","nomArchivo":"<name>"}}
+//
+// It is written as it is read, so the base64 encoding of the zip is never
+// held in memory. The hash goes after the zip, so it is computed while the
+// zip is encoded.
+type sendReceiptBody struct {
+	fileName string
+	zip      []byte
+}
+
+const (
+	sendReceiptBodyPrefix = `{"archivo":{"arcGreZip":"`
+	sendReceiptBodyHash   = `","hashZip":"`
+	sendReceiptBodyName   = `","nomArchivo":`
+	sendReceiptBodySuffix = `}}`
+)
+
+// size returns the length of the body, known before encoding it
+func (b sendReceiptBody) size() int64 {
+	name, _ := json.Marshal(b.fileName)
+
+	return int64(len(sendReceiptBodyPrefix) +
+		base64.StdEncoding.EncodedLen(len(b.zip)) +
+		len(sendReceiptBodyHash) + hex.EncodedLen(sha256.Size) +
+		len(sendReceiptBodyName) + len(name) +
+		len(sendReceiptBodySuffix))
+}
+
+func (b sendReceiptBody) writeTo(w io.Writer) error {
+	name, err := json.Marshal(b.fileName)
+	if err != nil {
+		return fmt.Errorf("error building send receipt payload: %w", err)
+	}
+
+	if _, err := io.WriteString(w, sendReceiptBodyPrefix); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := io.Copy(io.MultiWriter(h, enc), bytes.NewReader(b.zip)); err != nil {
+		return err
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s%s%s%s%s", sendReceiptBodyHash, hex.EncodeToString(h.Sum(nil)), sendReceiptBodyName, name, sendReceiptBodySuffix)
+
+	return err
+}
+
+// open returns a new reader of the body. It is written through a pipe
+// only once it is read, so a body that is never sent does not leave a
+// goroutine behind.
+func (b sendReceiptBody) open() io.ReadCloser {
+	return &pipeBody{write: b.writeTo}
+}
+
+type pipeBody struct {
+	write func(io.Writer) error
+	once  sync.Once
+	pr    *io.PipeReader
+}
+
+func (p *pipeBody) start() {
+	pr, pw := io.Pipe()
+	p.pr = pr
+
+	go func() {
+		pw.CloseWithError(p.write(pw))
+	}()
+}
+
+func (p *pipeBody) Read(buf []byte) (int, error) {
+	p.once.Do(p.start)
+	if p.pr == nil {
+		return 0, io.ErrClosedPipe
+	}
+
+	return p.pr.Read(buf)
+}
+
+// Close stops the writer if it was started, a body closed before being
+// read is never written
+func (p *pipeBody) Close() error {
+	p.once.Do(func() {})
+	if p.pr == nil {
+		return nil
+	}
 
+	return p.pr.Close()
 }
 
 // Creates an in memory zipFile with one content (the file in the argument)
@@ -151,7 +375,7 @@ func (s Sunat) createSingleFileZip(fileToCompressPath string, file io.Reader) (z
 
 	buf := new(bytes.Buffer)
 
-	s.Logger.Info("creating zip")
+	s.log().Info("creating zip")
 	zipWriter := zip.NewWriter(buf)
 	defer func() {
 		errzip := zipWriter.Close()
@@ -160,13 +384,13 @@ func (s Sunat) createSingleFileZip(fileToCompressPath string, file io.Reader) (z
 		}
 	}()
 
-	s.Logger.Info("creating first file inside zip")
+	s.log().Info("creating first file inside zip")
 	zw, err := zipWriter.Create(filepath.Base(fileToCompressPath))
 	if err != nil {
 		return nil, fmt.Errorf("error adding %s to zip file: %w", fileToCompressPath, err)
 	}
 
-	s.Logger.Info("adding file to zip archive")
+	s.log().Info("adding file to zip archive")
 	if _, err := io.Copy(zw, file); err != nil {
 		return nil, fmt.Errorf("error adding %s to zip file: %w", fileToCompressPath, err)
 	}
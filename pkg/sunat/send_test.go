@@ -3,9 +3,19 @@ package sunat
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateSingleFileZip(t *testing.T) {
@@ -49,3 +59,211 @@ func TestCreateSingleFileZip(t *testing.T) {
 		t.Fatalf("Expecting filecontents '%s', got '%s'", fileContents, string(c))
 	}
 }
+
+func TestSendReceiptBody(t *testing.T) {
+	zipContent := bytes.Repeat([]byte("zip content "), 10000)
+	payload := sendReceiptBody{fileName: "20123456789-09-T001-1.zip", zip: zipContent}
+
+	sum := sha256.Sum256(zipContent)
+	hash := hex.EncodeToString(sum[:])
+
+	expected, err := json.Marshal(map[string]any{
+		"archivo": map[string]any{
+			"nomArchivo": "20123456789-09-T001-1.zip",
+			"arcGreZip":  base64.StdEncoding.EncodeToString(zipContent),
+			"hashZip":    hash,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every reader (first attempt, retries) writes the same body
+	for i := 0; i < 2; i++ {
+		r := payload.open()
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, expected) {
+			t.Fatalf("unexpected body %.200s", got)
+		}
+	}
+
+	if payload.size() != int64(len(expected)) {
+		t.Fatalf("expected size %d, got %d", len(expected), payload.size())
+	}
+
+	// A body closed before being read is never written
+	if err := payload.open().Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendReceiptPayloadTooLarge(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	s := Sunat{Tokens: NewStaticTokenSource("token"), MaxPayloadSize: 1024}
+
+	_, err := s.SendReceipt(context.Background(), server.URL, SendReceiptParams{
+		ReceiptFilePath: "20123456789-09-T001-1.xml",
+		ZipFile:         make([]byte, 1024),
+	})
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected ErrPayloadTooLarge, got %v", err)
+	}
+
+	if calls != 0 {
+		t.Fatalf("expected no request, got %d", calls)
+	}
+
+	// A negative size disables the limit
+	s.MaxPayloadSize = -1
+	if _, err := s.SendReceipt(context.Background(), server.URL, SendReceiptParams{
+		ReceiptFilePath: "20123456789-09-T001-1.xml",
+		ZipFile:         make([]byte, DefaultMaxPayloadSize),
+	}); errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("expected no size limit, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected the receipt to be sent, got %d requests", calls)
+	}
+}
+
+func TestSendReceiptDeprecatedParams(t *testing.T) {
+	zipContent := []byte("zip content")
+
+	var gotBody, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"numTicket":"123"}`))
+	}))
+	defer server.Close()
+
+	zipBase64, err := EncodeFileBase64(bytes.NewReader(zipContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zipHash, err := HashFileContent(bytes.NewReader(zipContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := SendReceiptParams{
+		ReceiptFilePath:    "20123456789-09-T001-1.xml",
+		ZipFileBase64:      zipBase64,
+		ZipFileHash:        zipHash,
+		AuthorizationToken: "old-token",
+	}
+
+	res, err := Sunat{}.SendReceipt(context.Background(), server.URL, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.NumTicket != "123" {
+		t.Fatalf("expected ticket 123, got %s", res.NumTicket)
+	}
+
+	if gotAuth != "Bearer old-token" {
+		t.Fatalf("expected the AuthorizationToken to be sent, got '%s'", gotAuth)
+	}
+
+	expected, err := io.ReadAll(sendReceiptBody{fileName: "20123456789-09-T001-1.zip", zip: zipContent}.open())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotBody != string(expected) {
+		t.Fatalf("expected body %s, got %s", expected, gotBody)
+	}
+
+	params.ZipFileHash = "0000"
+	if _, err := (Sunat{}).SendReceipt(context.Background(), server.URL, params); err == nil {
+		t.Fatal("expected error for a hash that does not match the zip")
+	}
+}
+
+func TestSendOnceKeepsRecordWhenReceiptMayHaveArrived(t *testing.T) {
+	content, err := os.ReadFile("testdata/20123456789-09-T001-1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// Handler of the first send
+		handler    http.HandlerFunc
+		keepRecord bool
+	}{
+		{
+			name: "timeout after reading the body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			},
+			keepRecord: true,
+		},
+		{
+			name: "rejected by SUNAT",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte(`{"cod":"422","msg":"Validation failed"}`))
+			},
+			keepRecord: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			sendLog := NewSendLog(t.TempDir())
+			s := Sunat{
+				Tokens:             NewStaticTokenSource("token"),
+				Timeout:            200 * time.Millisecond,
+				SkipSignatureCheck: true,
+				SendLog:            &sendLog,
+			}
+
+			receiptPath := "20123456789-09-T001-1.xml"
+			if _, err := s.ZipAndSendReceipt(context.Background(), server.URL, receiptPath, bytes.NewReader(content)); err == nil {
+				t.Fatal("expected error")
+			}
+
+			record, ok, err := sendLog.Get("20123456789-09-T001-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ok != tt.keepRecord {
+				t.Fatalf("expected record kept=%v, got %v (%+v)", tt.keepRecord, ok, record)
+			}
+
+			if !tt.keepRecord {
+				return
+			}
+
+			if record.Status != SendStatusSending {
+				t.Fatalf("expected status %s, got %s", SendStatusSending, record.Status)
+			}
+
+			_, err = s.ZipAndSendReceipt(context.Background(), server.URL, receiptPath, bytes.NewReader(content))
+			if !errors.Is(err, ErrInterruptedSend) {
+				t.Fatalf("expected ErrInterruptedSend, got %v", err)
+			}
+		})
+	}
+}
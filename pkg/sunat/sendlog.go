@@ -0,0 +1,278 @@
+package sunat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/haguirrear/sunatapi/pkg/filelock"
+)
+
+type SendStatus string
+
+const (
+	// The receipt is being sent, no ticket was obtained yet. If the process
+	// stops at this point it is unknown whether SUNAT received it.
+	SendStatusSending SendStatus = "sending"
+	// SUNAT returned a ticket but its result was not obtained yet
+	SendStatusSent SendStatus = "sent"
+	// SUNAT accepted the receipt
+	SendStatusAccepted SendStatus = "accepted"
+	// SUNAT rejected the receipt
+	SendStatusRejected SendStatus = "rejected"
+)
+
+const (
+	sendLogFileExt = ".json"
+	// Folder of the index from tickets to documents
+	ticketsDir = "tickets"
+)
+
+// ErrInterruptedSend is returned when a previous send of the receipt was
+// interrupted before obtaining its ticket, so it is unknown whether SUNAT
+// received it
+var ErrInterruptedSend = errors.New("a previous send was interrupted before obtaining its ticket")
+
+var ErrAlreadySent = errors.New("receipt already sent")
+
+// AlreadySentError is returned by ZipAndSendReceipt when the receipt was
+// already accepted by SUNAT, or the same content is waiting for its result.
+// The ticket of the previous send can be polled instead of sending it again.
+type AlreadySentError struct {
+	Record SentReceipt
+	// SameContent reports whether the receipt was sent with the same content
+	SameContent bool
+}
+
+func (e *AlreadySentError) Error() string {
+	msg := fmt.Sprintf("%s: %s was sent on %s with ticket %s (%s)", ErrAlreadySent, e.Record.Document, e.Record.SentAt.Format(time.DateTime), e.Record.Ticket, e.Record.Status)
+	if !e.SameContent {
+		msg += " with a different content"
+	}
+
+	return msg
+}
+
+func (e *AlreadySentError) Is(target error) bool {
+	return target == ErrAlreadySent
+}
+
+// SentReceipt is the record of a receipt sent to SUNAT
+type SentReceipt struct {
+	Document string     `json:"document"`
+	SHA256   string     `json:"sha256"`
+	Ticket   string     `json:"ticket,omitempty"`
+	Status   SendStatus `json:"status"`
+	Code     string     `json:"code,omitempty"`
+	Message  string     `json:"message,omitempty"`
+	SentAt   time.Time  `json:"sent_at"`
+	// Last time the record changed
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Final reports whether SUNAT already gave its result for the receipt
+func (r SentReceipt) Final() bool {
+	return r.Status == SendStatusAccepted || r.Status == SendStatusRejected
+}
+
+// SendLog keeps on disk the receipts sent to SUNAT, so they are not sent
+// twice after a restart or by another process. Each document is stored in
+// its own file, named after its id (RUC-TIPO-SERIE-CORRELATIVO).
+type SendLog struct {
+	Dir string
+}
+
+// DefaultSendLogDir returns the folder used to keep the sent receipts
+// inside the user config directory (e.g. ~/.config/sunatapi/envios)
+func DefaultSendLogDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding user config folder: %w", err)
+	}
+
+	return filepath.Join(configDir, "sunatapi", "envios"), nil
+}
+
+func NewSendLog(dir string) SendLog {
+	return SendLog{Dir: dir}
+}
+
+// ContentHash returns the hex encoded SHA-256 of content, used to know if a
+// receipt changed since it was sent
+func ContentHash(content []byte) string {
+	h := sha256.Sum256(content)
+	return hex.EncodeToString(h[:])
+}
+
+func (l SendLog) recordPath(document string) string {
+	return filepath.Join(l.Dir, document+sendLogFileExt)
+}
+
+func (l SendLog) lockPath(document string) string {
+	return filepath.Join(l.Dir, document+lockFileExt)
+}
+
+// Get returns the record of document, if it was sent before
+func (l SendLog) Get(document string) (SentReceipt, bool, error) {
+	content, err := os.ReadFile(l.recordPath(document))
+	if errors.Is(err, os.ErrNotExist) {
+		return SentReceipt{}, false, nil
+	}
+
+	if err != nil {
+		return SentReceipt{}, false, fmt.Errorf("error reading send record: %w", err)
+	}
+
+	var record SentReceipt
+	if err := json.Unmarshal(content, &record); err != nil {
+		return SentReceipt{}, false, fmt.Errorf("error parsing send record %s: %w", l.recordPath(document), err)
+	}
+
+	return record, true, nil
+}
+
+// Put saves the record of its document. The file is replaced atomically so
+// a crash never leaves a partially written record.
+func (l SendLog) Put(record SentReceipt) error {
+	if err := os.MkdirAll(l.Dir, 0700); err != nil {
+		return fmt.Errorf("error creating send log folder: %w", err)
+	}
+
+	record.UpdatedAt = time.Now()
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializing send record: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(l.Dir, record.Document+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary send record: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing send record: %w", err)
+	}
+
+	// The record must survive a crash right after the receipt is sent
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing send record: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing send record: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), l.recordPath(record.Document)); err != nil {
+		return fmt.Errorf("error saving send record: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the record of document
+func (l SendLog) Delete(document string) error {
+	if err := os.Remove(l.recordPath(document)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing send record: %w", err)
+	}
+
+	return nil
+}
+
+func (l SendLog) ticketPath(ticket string) string {
+	return filepath.Join(l.Dir, ticketsDir, filepath.Base(ticket))
+}
+
+// PutTicket indexes ticket, so its result can be recorded with
+// RecordResult
+func (l SendLog) PutTicket(ticket, document string) error {
+	if err := os.MkdirAll(filepath.Join(l.Dir, ticketsDir), 0700); err != nil {
+		return fmt.Errorf("error creating send log folder: %w", err)
+	}
+
+	if err := os.WriteFile(l.ticketPath(ticket), []byte(document), 0600); err != nil {
+		return fmt.Errorf("error indexing ticket %s: %w", ticket, err)
+	}
+
+	return nil
+}
+
+// RecordResult updates the record of the document sent with ticket with
+// the result of SUNAT. Tickets not sent with this log are ignored.
+func (l SendLog) RecordResult(ctx context.Context, ticket string, r GetReceiptResponse) error {
+	if r.IsProcessing() {
+		return nil
+	}
+
+	document, err := os.ReadFile(l.ticketPath(ticket))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("error reading ticket index: %w", err)
+	}
+
+	lock, err := l.Lock(ctx, string(document))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	record, ok, err := l.Get(string(document))
+	// A newer send of the document replaced the one of this ticket
+	if err != nil || !ok || record.Ticket != ticket {
+		return err
+	}
+
+	switch {
+	case r.IsError():
+		record.Status = SendStatusRejected
+		record.Code = r.Error.NumError
+		record.Message = r.Error.Detail
+	case r.IsSuccess():
+		record.Status = SendStatusAccepted
+		record.Code = ""
+		record.Message = ""
+	default:
+		return nil
+	}
+
+	return l.Put(record)
+}
+
+// check returns an error if the receipt with hash should not be sent
+// because of its previous send. Rejected receipts can be sent again, and so
+// can a corrected one whose previous content was never accepted.
+func (l SendLog) check(document, hash string) error {
+	record, ok, err := l.Get(document)
+	if err != nil || !ok {
+		return err
+	}
+
+	sameContent := record.SHA256 == hash
+	switch {
+	case record.Status == SendStatusRejected:
+		return nil
+	case record.Status == SendStatusSending:
+		return fmt.Errorf("%w: %s", ErrInterruptedSend, document)
+	case record.Status == SendStatusSent && !sameContent:
+		return nil
+	default:
+		return &AlreadySentError{Record: record, SameContent: sameContent}
+	}
+}
+
+// Lock acquires an exclusive inter-process lock for document, so it is
+// not sent by two processes at the same time, waiting until ctx is done
+func (l SendLog) Lock(ctx context.Context, document string) (*filelock.Lock, error) {
+	return filelock.Acquire(ctx, l.lockPath(document))
+}
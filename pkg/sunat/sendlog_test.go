@@ -0,0 +1,168 @@
+package sunat
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSendLog(t *testing.T) {
+	log := NewSendLog(t.TempDir())
+	document := "20123456789-09-T001-1"
+
+	if _, ok, err := log.Get(document); ok || err != nil {
+		t.Fatalf("expected no record, got ok=%v err=%v", ok, err)
+	}
+
+	record := SentReceipt{
+		Document: document,
+		SHA256:   ContentHash([]byte("<DespatchAdvice/>")),
+		Ticket:   "123",
+		Status:   SendStatusSent,
+	}
+	if err := log.Put(record); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := log.Get(document)
+	if err != nil || !ok {
+		t.Fatalf("expected record, got ok=%v err=%v", ok, err)
+	}
+
+	if got.Ticket != "123" || got.SHA256 != record.SHA256 || got.Final() {
+		t.Fatalf("unexpected record %+v", got)
+	}
+
+	if got.UpdatedAt.IsZero() {
+		t.Fatal("expected UpdatedAt to be set")
+	}
+
+	got.Status = SendStatusAccepted
+	if err := log.Put(got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _, _ := log.Get(document); !got.Final() {
+		t.Fatalf("expected final record, got status %s", got.Status)
+	}
+
+	if err := log.Delete(document); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := log.Get(document); ok {
+		t.Fatal("expected record to be deleted")
+	}
+}
+
+func TestSendLogCheck(t *testing.T) {
+	document := "20123456789-09-T001-1"
+	hash := ContentHash([]byte("<DespatchAdvice/>"))
+	corrected := ContentHash([]byte("<DespatchAdvice></DespatchAdvice>"))
+
+	tests := []struct {
+		name   string
+		status SendStatus
+		hash   string
+		// Expected error, nil if the receipt can be sent
+		wantErr     error
+		sameContent bool
+	}{
+		{"interrupted send", SendStatusSending, hash, ErrInterruptedSend, false},
+		{"sent with the same content", SendStatusSent, hash, ErrAlreadySent, true},
+		{"sent with a different content", SendStatusSent, corrected, nil, false},
+		{"accepted with the same content", SendStatusAccepted, hash, ErrAlreadySent, true},
+		{"accepted with a different content", SendStatusAccepted, corrected, ErrAlreadySent, false},
+		{"rejected", SendStatusRejected, hash, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := NewSendLog(t.TempDir())
+			if err := log.Put(SentReceipt{Document: document, SHA256: hash, Ticket: "123", Status: tt.status}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := log.check(document, tt.hash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			var alreadySent *AlreadySentError
+			if errors.As(err, &alreadySent) && alreadySent.SameContent != tt.sameContent {
+				t.Fatalf("expected SameContent %v, got %v", tt.sameContent, alreadySent.SameContent)
+			}
+		})
+	}
+
+	if err := NewSendLog(t.TempDir()).check(document, hash); err != nil {
+		t.Fatalf("expected a receipt never sent to be allowed, got %v", err)
+	}
+}
+
+func TestSendLogRecordResult(t *testing.T) {
+	log := NewSendLog(t.TempDir())
+	document := "20123456789-09-T001-1"
+
+	put := func(ticket string) {
+		t.Helper()
+
+		if err := log.PutTicket(ticket, document); err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Put(SentReceipt{Document: document, Ticket: ticket, Status: SendStatusSent}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status := func() SentReceipt {
+		t.Helper()
+
+		record, ok, err := log.Get(document)
+		if err != nil || !ok {
+			t.Fatalf("expected record, got ok=%v err=%v", ok, err)
+		}
+
+		return record
+	}
+
+	put("1")
+
+	if err := log.RecordResult(context.Background(), "1", GetReceiptResponse{ResponseCode: TIcketProcessingResponseCode}); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got.Status != SendStatusSent {
+		t.Fatalf("expected still sent while processing, got %s", got.Status)
+	}
+
+	rejected := GetReceiptResponse{ResponseCode: TicketErrorResponseCode, Error: TicketError{NumError: "2335", Detail: "error"}}
+	if err := log.RecordResult(context.Background(), "1", rejected); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got.Status != SendStatusRejected || got.Code != "2335" || got.Message != "error" {
+		t.Fatalf("expected rejected record, got %+v", got)
+	}
+
+	// The corrected receipt is sent again with a new ticket
+	put("2")
+
+	// The result of the old ticket does not replace the one of the new send
+	if err := log.RecordResult(context.Background(), "1", rejected); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got.Status != SendStatusSent || got.Ticket != "2" {
+		t.Fatalf("expected the new send to be kept, got %+v", got)
+	}
+
+	if err := log.RecordResult(context.Background(), "2", GetReceiptResponse{ResponseCode: TicketSuccessResponseCode}); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got.Status != SendStatusAccepted || got.Code != "" || got.Message != "" {
+		t.Fatalf("expected accepted record, got %+v", got)
+	}
+
+	// Tickets not sent with this log are ignored
+	if err := log.RecordResult(context.Background(), "unknown", rejected); err != nil {
+		t.Fatal(err)
+	}
+}
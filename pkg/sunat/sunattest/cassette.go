@@ -0,0 +1,339 @@
+// Package sunattest records real interactions with SUNAT into cassette files
+// and replays them, so code using pkg/sunat can be tested without network
+// access.
+//
+// Record once against SUNAT (credentials are scrubbed before saving, with
+// the same Redactor given to the client for its logs and HAR file):
+//
+//	rec, _ := sunattest.New("testdata/procesar.json", sunattest.ModeRecord, nil)
+//	rec.Redactor = redactor
+//	s := sunat.Sunat{HTTPClient: rec.Client(), Redactor: redactor}
+//	...
+//	rec.Save()
+//
+// and replay it in the tests:
+//
+//	rec, _ := sunattest.New("testdata/procesar.json", sunattest.ModeReplay, nil)
+package sunattest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+)
+
+type Mode int
+
+const (
+	// Requests are answered with the interactions in the cassette
+	ModeReplay Mode = iota
+	// Requests are sent to SUNAT and the interactions are saved
+	ModeRecord
+)
+
+var ErrNoInteraction = errors.New("sunattest: no recorded interaction matches the request")
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that records or replays a cassette.
+// It is safe for concurrent use.
+type Recorder struct {
+	// Redactor masks the credentials before saving the interactions and
+	// when matching them, sunat.DefaultRedactor if nil. It always masks,
+	// even if it is disabled for the logs.
+	Redactor *sunat.Redactor
+
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New returns a Recorder for the cassette in path. In ModeRecord requests
+// are sent with transport (http.DefaultTransport if nil). In ModeReplay the
+// cassette must exist.
+func New(path string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	r := &Recorder{path: path, mode: mode, transport: transport}
+
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("sunattest: error reading cassette: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &r.cassette); err != nil {
+		return nil, fmt.Errorf("sunattest: error parsing cassette %s: %w", path, err)
+	}
+
+	r.used = make([]bool, len(r.cassette.Interactions))
+
+	return r, nil
+}
+
+// Client returns an *http.Client that uses the recorder
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+
+	return r.replay(req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	redactor := r.redactor()
+	key := matchKey(redactor, req.Method, req.URL, req.Header.Get("Content-Type"), body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Identical requests (e.g. polling a ticket) get the responses in the
+	// order they were recorded
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] {
+			continue
+		}
+
+		u, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			continue
+		}
+
+		recorded := matchKey(redactor, interaction.Request.Method, u, interaction.Request.Headers.Get("Content-Type"), []byte(interaction.Request.Body))
+		if recorded != key {
+			continue
+		}
+
+		r.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.Path)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	res, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("sunattest: error reading response: %w", err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	redactor := r.redactor()
+	interaction := Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     redactor.URL(req.URL),
+			Headers: scrubHeaders(redactor, req.Header),
+			Body:    string(redactor.Body(req.Header.Get("Content-Type"), body)),
+		},
+		Response: Response{
+			Status:  res.StatusCode,
+			Headers: scrubHeaders(redactor, res.Header),
+			Body:    string(redactor.Body(res.Header.Get("Content-Type"), resBody)),
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+func (r *Recorder) redactor() *sunat.Redactor {
+	if r.Redactor == nil {
+		return sunat.DefaultRedactor
+	}
+
+	if !r.Redactor.Disabled {
+		return r.Redactor
+	}
+
+	// Cassettes are committed, secrets are always masked
+	enabled := *r.Redactor
+	enabled.Disabled = false
+
+	return &enabled
+}
+
+// Save writes the recorded interactions to the cassette file
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	content, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("sunattest: error serializing cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("sunattest: error creating cassette folder: %w", err)
+	}
+
+	return os.WriteFile(r.path, content, 0644)
+}
+
+// Unused returns the recorded interactions that were not replayed, useful
+// to check that a test made all the expected requests
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+
+	return unused
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("sunattest: error reading request body: %w", err)
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+// Headers that change in every execution and are not useful in a cassette
+var skippedHeaders = []string{"Date", "Content-Length", "User-Agent", "Accept-Encoding"}
+
+func scrubHeaders(redactor *sunat.Redactor, h http.Header) http.Header {
+	scrubbed := http.Header{}
+	for name, values := range h {
+		if containsFold(skippedHeaders, name) {
+			continue
+		}
+
+		for _, v := range values {
+			scrubbed.Add(name, redactor.Header(name, v))
+		}
+	}
+
+	return scrubbed
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchKey identifies a request by method, path and normalized body. The
+// path and body are redacted, so requests with different credentials still
+// match, and JSON/form bodies are compared regardless of the order of their
+// keys.
+func matchKey(redactor *sunat.Redactor, method string, u *url.URL, contentType string, body []byte) string {
+	path := u.Path
+	if redacted, err := url.Parse(redactor.URL(u)); err == nil {
+		path = redacted.Path
+	}
+
+	return method + " " + path + "\n" + normalizeBody(contentType, redactor.Body(contentType, body))
+}
+
+func normalizeBody(contentType string, body []byte) string {
+	switch {
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return string(body)
+		}
+
+		// url.Values.Encode sorts by key
+		return form.Encode()
+	case strings.Contains(contentType, "json"):
+		var parsed any
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return string(body)
+		}
+
+		// Maps are marshalled with sorted keys
+		normalized, err := json.Marshal(parsed)
+		if err != nil {
+			return string(body)
+		}
+
+		return string(normalized)
+	default:
+		return strings.TrimSpace(string(body))
+	}
+}
@@ -0,0 +1,165 @@
+package sunattest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haguirrear/sunatapi/pkg/sunat"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"real-token","expires_in":3600}`)
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	form := url.Values{"grant_type": {"password"}, "password": {"real-password"}}
+
+	rec, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := rec.Client().PostForm(server.URL+"/oauth2/token/", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	server.Close()
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"real-token", "real-password"} {
+		if strings.Contains(string(content), secret) {
+			t.Fatalf("cassette contains '%s'", secret)
+		}
+	}
+
+	replay, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other credentials and host still match the recorded request
+	form.Set("password", "other-password")
+	res, err = replay.Client().PostForm("https://api-seguridad.sunat.gob.pe/oauth2/token/", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	}
+
+	if _, err := replay.Client().PostForm("https://api-seguridad.sunat.gob.pe/oauth2/token/", form); err == nil {
+		t.Fatal("expected error, the only interaction was already replayed")
+	}
+}
+
+func TestRecordRedactsClientIDAndUser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"real-token","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := sunat.Sunat{HTTPClient: rec.Client()}
+	params := sunat.AuthParams{ClientID: "real-client-id", ClientSecret: "secret", Username: "20123456789REALUSER", Password: "clave"}
+	if _, err := s.GetToken(context.Background(), server.URL, params); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"real-client-id", "20123456789REALUSER"} {
+		if strings.Contains(string(content), secret) {
+			t.Fatalf("cassette contains '%s':\n%s", secret, content)
+		}
+	}
+
+	// Replayed with other credentials
+	replay, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.HTTPClient = replay.Client()
+	params.ClientID, params.Username = "other-client-id", "20123456789OTHER"
+	if _, err := s.GetToken(context.Background(), server.URL, params); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordUsesRedactor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"numTicket":"123","custom_secret":"custom-value"}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same rules as --redact-field, even if disabled for the logs
+	rec.Redactor = sunat.NewRedactor("custom_secret", "X-Custom-Key")
+	rec.Redactor.Disabled = true
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/contribuyente/gem/comprobantes/envios/123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Custom-Key", "header-value")
+
+	res, err := rec.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"custom-value", "header-value"} {
+		if strings.Contains(string(content), secret) {
+			t.Fatalf("cassette contains '%s':\n%s", secret, content)
+		}
+	}
+}
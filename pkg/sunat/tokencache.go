@@ -0,0 +1,223 @@
+package sunat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/haguirrear/sunatapi/pkg/filelock"
+)
+
+// Tokens are renewed this long before they actually expire
+const DefaultTokenExpiryMargin = 60 * time.Second
+
+const (
+	tokenFileExt = ".json"
+	lockFileExt  = ".lock"
+)
+
+// TokenCache stores access tokens on disk so they can be shared between
+// several executions (and processes) until shortly before they expire.
+// Each token is stored in its own file, keyed by auth base URL, ClientID,
+// Username, grant type and scope.
+type TokenCache struct {
+	Dir    string
+	Margin time.Duration
+}
+
+// DefaultTokenCacheDir returns the folder used to cache tokens inside the
+// user cache directory (e.g. ~/.cache/sunatapi/tokens)
+func DefaultTokenCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding user cache folder: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "sunatapi", "tokens"), nil
+}
+
+func NewTokenCache(dir string) TokenCache {
+	return TokenCache{Dir: dir, Margin: DefaultTokenExpiryMargin}
+}
+
+// TokenCacheKey identifies the token of a ClientID+Username pair without
+// revealing them in the file name. Tokens for different auth base URLs
+// (e.g. beta and production), scopes or grant types are kept side by side.
+func TokenCacheKey(baseURL string, params AuthParams) string {
+	h := sha256.New()
+	h.Write([]byte(strings.TrimRight(baseURL, "/")))
+	h.Write([]byte{0})
+	h.Write([]byte(params.ClientID))
+	h.Write([]byte{0})
+	if params.grantType() == GrantTypePassword {
+		h.Write([]byte(params.Username))
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(params.grantType()))
+	h.Write([]byte{0})
+	h.Write([]byte(params.scope()))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c TokenCache) tokenPath(key string) string {
+	return filepath.Join(c.Dir, key+tokenFileExt)
+}
+
+func (c TokenCache) lockPath(key string) string {
+	return filepath.Join(c.Dir, key+lockFileExt)
+}
+
+// Get returns the cached token for key if it exists and is still valid
+func (c TokenCache) Get(key string) (Token, bool, error) {
+	content, err := os.ReadFile(c.tokenPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return Token{}, false, nil
+	}
+
+	if err != nil {
+		return Token{}, false, fmt.Errorf("error reading cached token: %w", err)
+	}
+
+	var token Token
+	if err := json.Unmarshal(content, &token); err != nil {
+		// A corrupted cache entry is the same as a missing one
+		return Token{}, false, nil
+	}
+
+	if !token.IsValid(c.Margin) {
+		return Token{}, false, nil
+	}
+
+	return token, true, nil
+}
+
+// Put saves token for key. The file is replaced atomically so readers never
+// see a partially written token.
+func (c TokenCache) Put(key string, token Token) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return fmt.Errorf("error creating token cache folder: %w", err)
+	}
+
+	content, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("error serializing token: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.Dir, key+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing token file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing token file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.tokenPath(key)); err != nil {
+		return fmt.Errorf("error saving token file: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the cached token for key
+func (c TokenCache) Delete(key string) error {
+	if err := os.Remove(c.tokenPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing cached token: %w", err)
+	}
+
+	return nil
+}
+
+// Lock acquires an exclusive inter-process lock for key, waiting until ctx
+// is done
+func (c TokenCache) Lock(ctx context.Context, key string) (*filelock.Lock, error) {
+	return filelock.Acquire(ctx, c.lockPath(key))
+}
+
+// Clear removes every cached token and returns how many were removed. The
+// lock files are kept: another process may hold one, and a new file would
+// let a third process lock it at the same time.
+func (c TokenCache) Clear() (int, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("error reading token cache folder: %w", err)
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		name := e.Name()
+		if !strings.HasSuffix(name, tokenFileExt) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(c.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("error removing cached token %s: %w", name, err)
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// GetCachedToken returns a valid token from cache or requests a new one and
+// stores it. The cache entry is locked while the token is requested, so
+// concurrent processes wait for the first one instead of all hitting the
+// auth endpoint.
+func (s Sunat) GetCachedToken(ctx context.Context, baseURL string, params AuthParams, cache TokenCache) (Token, error) {
+	key := TokenCacheKey(baseURL, params)
+
+	lock, err := cache.Lock(ctx, key)
+	if ctx.Err() != nil {
+		return Token{}, err
+	}
+
+	if err != nil {
+		s.log().Warnf("Could not lock token cache, requesting a new token: %v", err)
+		return s.GetToken(ctx, baseURL, params)
+	}
+	defer lock.Release()
+
+	token, ok, err := cache.Get(key)
+	if err != nil {
+		s.log().Warnf("Could not read token cache: %v", err)
+	}
+
+	if ok {
+		s.log().Debugf("Using cached token, expires at %s", token.ExpiresAt.Format(time.RFC3339))
+		return token, nil
+	}
+
+	token, err = s.GetToken(ctx, baseURL, params)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if err := cache.Put(key, token); err != nil {
+		s.log().Warnf("Could not save token in cache: %v", err)
+	}
+
+	return token, nil
+}
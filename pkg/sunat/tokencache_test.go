@@ -0,0 +1,92 @@
+package sunat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTokenCacheExpiry(t *testing.T) {
+	cache := NewTokenCache(t.TempDir())
+	key := TokenCacheKey("https://api-seguridad.sunat.gob.pe", AuthParams{ClientID: "client", Username: "20123456789USER"})
+
+	if _, ok, err := cache.Get(key); ok || err != nil {
+		t.Fatalf("expected empty cache, got ok=%v err=%v", ok, err)
+	}
+
+	expiring := Token{AccessToken: "old", ExpiresAt: time.Now().Add(30 * time.Second)}
+	if err := cache.Put(key, expiring); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := cache.Get(key); ok {
+		t.Fatal("expected token inside the expiry margin to be discarded")
+	}
+
+	valid := Token{AccessToken: "new", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := cache.Put(key, valid); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := cache.Get(key)
+	if err != nil || !ok {
+		t.Fatalf("expected cached token, got ok=%v err=%v", ok, err)
+	}
+
+	if got.AccessToken != "new" {
+		t.Fatalf("expected token 'new', got '%s'", got.AccessToken)
+	}
+
+	lock, err := cache.Lock(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+
+	removed, err := cache.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 1 {
+		t.Fatalf("expected 1 removed token, got %d", removed)
+	}
+
+	// A lock held by another process must stay the same file
+	if _, err := os.Stat(cache.lockPath(key)); err != nil {
+		t.Fatalf("expected the lock file to be kept: %v", err)
+	}
+}
+
+func TestGetCachedTokenReusesToken(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"JWT","expires_in":3600}`, calls)
+	}))
+	defer server.Close()
+
+	s := Sunat{}
+	cache := NewTokenCache(t.TempDir())
+	params := AuthParams{ClientID: "client", Username: "user"}
+
+	for i := 0; i < 3; i++ {
+		token, err := s.GetCachedToken(context.Background(), server.URL, params, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.AccessToken != "token-1" {
+			t.Fatalf("expected 'token-1', got '%s'", token.AccessToken)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected 1 call to the auth endpoint, got %d", calls)
+	}
+}
@@ -0,0 +1,150 @@
+package sunat
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrNoTokenSource = errors.New("no token source configured")
+var ErrTokenNotRefreshable = errors.New("token cannot be refreshed")
+
+// TokenSource provides the access token used to authorize requests to SUNAT.
+// Implementations must be safe for concurrent use.
+type TokenSource interface {
+	// Token returns a token ready to be used, renewing it if it's expired
+	Token(ctx context.Context) (Token, error)
+	// Refresh discards the current token (e.g. after it was rejected by
+	// SUNAT) and obtains a new one
+	Refresh(ctx context.Context) (Token, error)
+}
+
+type staticTokenSource struct {
+	token Token
+}
+
+// NewStaticTokenSource returns a TokenSource that always returns the same
+// access token. It cannot be refreshed.
+func NewStaticTokenSource(accessToken string) TokenSource {
+	return staticTokenSource{token: Token{AccessToken: accessToken}}
+}
+
+func (s staticTokenSource) Token(ctx context.Context) (Token, error) {
+	return s.token, nil
+}
+
+func (s staticTokenSource) Refresh(ctx context.Context) (Token, error) {
+	return Token{}, ErrTokenNotRefreshable
+}
+
+type passwordTokenSource struct {
+	sunat   Sunat
+	baseURL string
+	params  AuthParams
+
+	mu    sync.Mutex
+	token Token
+}
+
+// NewPasswordTokenSource returns a TokenSource that requests tokens with the
+// given credentials and keeps them in memory until shortly before they expire
+func NewPasswordTokenSource(s Sunat, baseURL string, params AuthParams) TokenSource {
+	return &passwordTokenSource{sunat: s, baseURL: baseURL, params: params}
+}
+
+func (p *passwordTokenSource) Token(ctx context.Context) (Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token.IsValid(DefaultTokenExpiryMargin) {
+		return p.token, nil
+	}
+
+	return p.renew(ctx)
+}
+
+func (p *passwordTokenSource) Refresh(ctx context.Context) (Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.renew(ctx)
+}
+
+func (p *passwordTokenSource) renew(ctx context.Context) (Token, error) {
+	token, err := p.sunat.GetToken(ctx, p.baseURL, p.params)
+	if err != nil {
+		p.token = Token{}
+		return Token{}, err
+	}
+
+	p.token = token
+	return token, nil
+}
+
+type cachedTokenSource struct {
+	sunat   Sunat
+	baseURL string
+	params  AuthParams
+	cache   TokenCache
+
+	mu    sync.Mutex
+	token Token
+}
+
+// NewCachedTokenSource returns a TokenSource backed by a TokenCache, so the
+// token is shared with other processes using the same cache
+func NewCachedTokenSource(s Sunat, baseURL string, params AuthParams, cache TokenCache) TokenSource {
+	return &cachedTokenSource{sunat: s, baseURL: baseURL, params: params, cache: cache}
+}
+
+func (c *cachedTokenSource) Token(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.IsValid(c.cache.Margin) {
+		return c.token, nil
+	}
+
+	token, err := c.sunat.GetCachedToken(ctx, c.baseURL, c.params, c.cache)
+	if err != nil {
+		return Token{}, err
+	}
+
+	c.token = token
+	return token, nil
+}
+
+func (c *cachedTokenSource) Refresh(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rejected := c.token
+	c.token = Token{}
+
+	key := TokenCacheKey(c.baseURL, c.params)
+	lock, err := c.cache.Lock(ctx, key)
+	if err != nil {
+		return Token{}, err
+	}
+	defer lock.Release()
+
+	// Another process may have already replaced the rejected token
+	cached, ok, _ := c.cache.Get(key)
+	if ok && cached.AccessToken != rejected.AccessToken {
+		c.token = cached
+		return cached, nil
+	}
+
+	token, err := c.sunat.GetToken(ctx, c.baseURL, c.params)
+	if err != nil {
+		c.cache.Delete(key)
+		return Token{}, err
+	}
+
+	if err := c.cache.Put(key, token); err != nil {
+		c.sunat.log().Warnf("Could not save token in cache: %v", err)
+	}
+
+	c.token = token
+	return token, nil
+}
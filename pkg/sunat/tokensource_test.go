@@ -0,0 +1,64 @@
+package sunat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type countingTokenSource struct {
+	refreshes int
+}
+
+func (c *countingTokenSource) Token(ctx context.Context) (Token, error) {
+	return Token{AccessToken: fmt.Sprintf("token-%d", c.refreshes)}, nil
+}
+
+func (c *countingTokenSource) Refresh(ctx context.Context) (Token, error) {
+	c.refreshes++
+	return c.Token(ctx)
+}
+
+func TestRefreshTokenOnUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"codRespuesta":"0","arcCdr":"cdr","indCdrGenerado":"1"}`)
+	}))
+	defer server.Close()
+
+	tokens := &countingTokenSource{}
+	s := Sunat{Tokens: tokens}
+
+	receipt, err := s.GetReceipt(context.Background(), server.URL, "ticket")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !receipt.IsSuccess() {
+		t.Fatalf("expected successful receipt, got code '%s'", receipt.ResponseCode)
+	}
+
+	if tokens.refreshes != 1 {
+		t.Fatalf("expected 1 token refresh, got %d", tokens.refreshes)
+	}
+}
+
+func TestStaticTokenSourceIsNotRefreshed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	s := Sunat{Tokens: NewStaticTokenSource("expired")}
+
+	if _, err := s.GetReceipt(context.Background(), server.URL, "ticket"); err == nil {
+		t.Fatal("expected error with rejected static token")
+	}
+}
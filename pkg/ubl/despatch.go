@@ -0,0 +1,195 @@
+package ubl
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Values required by SUNAT for the guía de remisión electrónica
+const (
+	UBLVersion      = "2.1"
+	CustomizationID = "2.0"
+
+	// Guía de remisión remitente
+	DespatchAdviceTypeShipper = "09"
+	// Guía de remisión transportista
+	DespatchAdviceTypeCarrier = "31"
+)
+
+var documentIDRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]{3}-[0-9]{1,8}$`)
+
+func equals(expected string) func(n *node) string {
+	return func(n *node) string {
+		if n.text != expected {
+			return fmt.Sprintf("expected '%s', found '%s'", expected, n.text)
+		}
+		return ""
+	}
+}
+
+func notEmpty(n *node) string {
+	if n.text == "" {
+		return "must not be empty"
+	}
+	return ""
+}
+
+func matches(re *regexp.Regexp, format string) func(n *node) string {
+	return func(n *node) string {
+		if !re.MatchString(n.text) {
+			return fmt.Sprintf("'%s' does not have the format %s", n.text, format)
+		}
+		return ""
+	}
+}
+
+func timeLayout(layout string) func(n *node) string {
+	return func(n *node) string {
+		if _, err := time.Parse(layout, n.text); err != nil {
+			return fmt.Sprintf("'%s' does not have the format %s", n.text, layout)
+		}
+		return ""
+	}
+}
+
+func oneOf(values ...string) func(n *node) string {
+	return func(n *node) string {
+		for _, v := range values {
+			if n.text == v {
+				return ""
+			}
+		}
+		return fmt.Sprintf("'%s' is not one of %v", n.text, values)
+	}
+}
+
+// quantity checks a positive number with its unitCode attribute
+func quantity(n *node) string {
+	if v, err := strconv.ParseFloat(n.text, 64); err != nil || v <= 0 {
+		return fmt.Sprintf("'%s' is not a positive number", n.text)
+	}
+	if n.attr("unitCode") == "" {
+		return "missing attribute unitCode"
+	}
+	return ""
+}
+
+// identifier checks a document number with its schemeID attribute (tipo de
+// documento de identidad, catálogo 06)
+func identifier(n *node) string {
+	if n.text == "" {
+		return "must not be empty"
+	}
+	if n.attr("schemeID") == "" {
+		return "missing attribute schemeID"
+	}
+	return ""
+}
+
+func partyRule(local string) rule {
+	return rule{space: NamespaceCAC, local: local, min: 1, max: 1, children: []rule{
+		{space: NamespaceCAC, local: "Party", min: 1, max: 1, children: []rule{
+			{space: NamespaceCAC, local: "PartyIdentification", min: 1, max: 1, children: []rule{
+				{space: NamespaceCBC, local: "ID", min: 1, max: 1, check: identifier},
+			}},
+			{space: NamespaceCAC, local: "PartyLegalEntity", min: 1, max: 1, children: []rule{
+				{space: NamespaceCBC, local: "RegistrationName", min: 1, max: 1, check: notEmpty},
+			}},
+		}},
+	}}
+}
+
+func addressRule(local string) rule {
+	return rule{space: NamespaceCAC, local: local, min: 1, max: 1, children: []rule{
+		{space: NamespaceCBC, local: "ID", min: 1, max: 1, check: notEmpty},
+		{space: NamespaceCAC, local: "AddressLine", min: 1, max: 1, children: []rule{
+			{space: NamespaceCBC, local: "Line", min: 1, max: 1, check: notEmpty},
+		}},
+	}}
+}
+
+// despatchAdviceRules are the elements of the root DespatchAdvice
+var despatchAdviceRules = []rule{
+	{space: NamespaceEXT, local: "UBLExtensions", max: 1},
+	{space: NamespaceCBC, local: "UBLVersionID", min: 1, max: 1, check: equals(UBLVersion)},
+	{space: NamespaceCBC, local: "CustomizationID", min: 1, max: 1, check: equals(CustomizationID)},
+	{space: NamespaceCBC, local: "ID", min: 1, max: 1, check: matches(documentIDRegex, "SERIE-CORRELATIVO")},
+	{space: NamespaceCBC, local: "IssueDate", min: 1, max: 1, check: timeLayout(time.DateOnly)},
+	{space: NamespaceCBC, local: "IssueTime", min: 1, max: 1, check: timeLayout(time.TimeOnly)},
+	{space: NamespaceCBC, local: "DespatchAdviceTypeCode", min: 1, max: 1, check: oneOf(DespatchAdviceTypeShipper, DespatchAdviceTypeCarrier)},
+	partyRule("DespatchSupplierParty"),
+	partyRule("DeliveryCustomerParty"),
+	{space: NamespaceCAC, local: "Shipment", min: 1, max: 1, children: []rule{
+		{space: NamespaceCBC, local: "ID", min: 1, max: 1, check: notEmpty},
+		{space: NamespaceCBC, local: "HandlingCode", max: 1, check: notEmpty},
+		{space: NamespaceCBC, local: "GrossWeightMeasure", min: 1, max: 1, check: quantity},
+		{space: NamespaceCAC, local: "ShipmentStage", min: 1, children: []rule{
+			{space: NamespaceCBC, local: "TransportModeCode", max: 1, check: notEmpty},
+			{space: NamespaceCAC, local: "TransitPeriod", min: 1, max: 1, children: []rule{
+				{space: NamespaceCBC, local: "StartDate", min: 1, max: 1, check: timeLayout(time.DateOnly)},
+			}},
+		}},
+		{space: NamespaceCAC, local: "Delivery", min: 1, max: 1, children: []rule{
+			addressRule("DeliveryAddress"),
+			{space: NamespaceCAC, local: "Despatch", min: 1, max: 1, children: []rule{
+				addressRule("DespatchAddress"),
+			}},
+		}},
+	}},
+	{space: NamespaceCAC, local: "DespatchLine", min: 1, children: []rule{
+		{space: NamespaceCBC, local: "ID", min: 1, max: 1, check: notEmpty},
+		{space: NamespaceCBC, local: "DeliveredQuantity", min: 1, max: 1, check: quantity},
+		{space: NamespaceCAC, local: "OrderLineReference", min: 1, max: 1, children: []rule{
+			{space: NamespaceCBC, local: "LineID", min: 1, max: 1, check: notEmpty},
+		}},
+		{space: NamespaceCAC, local: "Item", min: 1, max: 1, children: []rule{
+			{space: NamespaceCBC, local: "Description", min: 1, max: 1, check: notEmpty},
+		}},
+	}},
+}
+
+// ValidateDespatchAdvice checks that r is a well formed UBL 2.1
+// DespatchAdvice (guía de remisión electrónica) with every mandatory
+// element required by SUNAT. It returns ValidationErrors with every
+// problem found, or nil if the document is valid.
+func ValidateDespatchAdvice(r io.Reader) error {
+	root, err := parse(r)
+	if err != nil {
+		return err
+	}
+
+	if root.name.Local != "DespatchAdvice" || root.name.Space != NamespaceDespatchAdvice {
+		return ValidationErrors{{
+			Path:    root.path,
+			Line:    root.line,
+			Message: fmt.Sprintf("root element must be DespatchAdvice in namespace %s, found %s in '%s'", NamespaceDespatchAdvice, root.name.Local, root.name.Space),
+		}}
+	}
+
+	errs := validateChildren(root, despatchAdviceRules)
+
+	// The motivo de traslado is mandatory for the guía del remitente
+	for _, typeCode := range root.find("DespatchAdviceTypeCode") {
+		if typeCode.text != DespatchAdviceTypeShipper {
+			continue
+		}
+
+		for _, shipment := range root.find("Shipment") {
+			if len(shipment.find("HandlingCode")) == 0 {
+				errs = append(errs, ValidationError{
+					Path:    shipment.path + "/cbc:HandlingCode",
+					Message: "missing mandatory element cbc:HandlingCode for despatch advice type 09",
+				})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
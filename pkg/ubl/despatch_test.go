@@ -0,0 +1,105 @@
+package ubl
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func readTestDespatchAdvice(t *testing.T) string {
+	t.Helper()
+
+	content, err := os.ReadFile("testdata/20123456789-09-T001-1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestValidateDespatchAdvice(t *testing.T) {
+	if err := ValidateDespatchAdvice(strings.NewReader(readTestDespatchAdvice(t))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateDespatchAdviceErrors(t *testing.T) {
+	valid := readTestDespatchAdvice(t)
+
+	tests := []struct {
+		name    string
+		xml     string
+		path    string
+		message string
+	}{
+		{
+			name:    "malformed",
+			xml:     strings.Replace(valid, "</cbc:ID>", "", 1),
+			path:    "/",
+			message: "malformed xml",
+		},
+		{
+			name:    "wrong root namespace",
+			xml:     strings.Replace(valid, NamespaceDespatchAdvice, "urn:example", 1),
+			path:    "/DespatchAdvice",
+			message: "root element must be DespatchAdvice",
+		},
+		{
+			name:    "wrong version",
+			xml:     strings.Replace(valid, "<cbc:UBLVersionID>2.1", "<cbc:UBLVersionID>2.0", 1),
+			path:    "/DespatchAdvice/cbc:UBLVersionID[1]",
+			message: "expected '2.1'",
+		},
+		{
+			name:    "missing customization",
+			xml:     strings.Replace(valid, "<cbc:CustomizationID>2.0</cbc:CustomizationID>", "", 1),
+			path:    "/DespatchAdvice/cbc:CustomizationID",
+			message: "missing mandatory element",
+		},
+		{
+			name:    "missing item description",
+			xml:     strings.Replace(valid, "<cbc:Description>CAJA DE PRODUCTOS</cbc:Description>", "", 1),
+			path:    "/DespatchAdvice/cac:DespatchLine[1]/cac:Item[1]/cbc:Description",
+			message: "missing mandatory element",
+		},
+		{
+			name:    "duplicated shipment",
+			xml:     strings.Replace(valid, "<cac:DespatchLine>", "<cac:Shipment><cbc:ID>2</cbc:ID></cac:Shipment><cac:DespatchLine>", 1),
+			path:    "/DespatchAdvice/cac:Shipment[2]",
+			message: "appears 2 times",
+		},
+		{
+			name:    "wrong element namespace",
+			xml:     strings.Replace(valid, "<cbc:IssueDate>2024-06-10</cbc:IssueDate>", "<cac:IssueDate>2024-06-10</cac:IssueDate>", 1),
+			path:    "/DespatchAdvice/cac:IssueDate[1]",
+			message: "must be in namespace",
+		},
+		{
+			name:    "missing handling code",
+			xml:     strings.Replace(valid, `<cbc:HandlingCode listAgencyName="PE:SUNAT" listName="Motivo de traslado" listURI="urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo20">01</cbc:HandlingCode>`, "", 1),
+			path:    "/DespatchAdvice/cac:Shipment[1]/cbc:HandlingCode",
+			message: "type 09",
+		},
+	}
+
+	for _, tt := range tests {
+		err := ValidateDespatchAdvice(strings.NewReader(tt.xml))
+
+		var errs ValidationErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("%s: expected ValidationErrors, got %v", tt.name, err)
+		}
+
+		found := false
+		for _, e := range errs {
+			if e.Path == tt.path && strings.Contains(e.Message, tt.message) {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Fatalf("%s: expected error at %s containing '%s', got %v", tt.name, tt.path, tt.message, []ValidationError(errs))
+		}
+	}
+}
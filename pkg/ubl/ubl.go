@@ -0,0 +1,222 @@
+// Package ubl validates the structure of UBL 2.1 documents before they are
+// sent to SUNAT. It is not a full XSD validation, it only checks the rules
+// SUNAT most often rejects documents for: namespaces, versions and the
+// presence and cardinality of mandatory elements.
+package ubl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Namespaces used by UBL 2.1 documents
+const (
+	NamespaceDespatchAdvice = "urn:oasis:names:specification:ubl:schema:xsd:DespatchAdvice-2"
+	NamespaceCBC            = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+	NamespaceCAC            = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	NamespaceEXT            = "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2"
+	NamespaceDS             = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+var prefixes = map[string]string{
+	NamespaceCBC: "cbc",
+	NamespaceCAC: "cac",
+	NamespaceEXT: "ext",
+	NamespaceDS:  "ds",
+}
+
+// ValidationError is a problem found in an element of the document
+type ValidationError struct {
+	// XPath of the element, e.g. /DespatchAdvice/cac:Shipment[1]/cbc:ID
+	Path string
+	// Line of the element, 0 if it is missing
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Path, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors is returned when a document is not valid. Use errors.As
+// to get every problem found.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return fmt.Sprintf("invalid document: %s", e[0].Error())
+	}
+
+	return fmt.Sprintf("invalid document: %d errors, first: %s", len(e), e[0].Error())
+}
+
+// node is an element of the parsed document
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	line     int
+	path     string
+	children []*node
+}
+
+func (n *node) attr(local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+// find returns the children of n named local, whatever their namespace
+func (n *node) find(local string) []*node {
+	var found []*node
+	for _, c := range n.children {
+		if c.name.Local == local {
+			found = append(found, c)
+		}
+	}
+
+	return found
+}
+
+func qualifiedName(name xml.Name) string {
+	if prefix, ok := prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+
+	return name.Local
+}
+
+// parse reads the whole document. Errors are reported as ValidationErrors
+// when the document is not well formed.
+func parse(r io.Reader) (*node, error) {
+	decoder := xml.NewDecoder(r)
+
+	var root *node
+	var stack []*node
+	var text strings.Builder
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			line, _ := decoder.InputPos()
+			return nil, ValidationErrors{{Path: "/", Line: line, Message: fmt.Sprintf("malformed xml: %v", err)}}
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			line, _ := decoder.InputPos()
+			n := &node{name: t.Name, attrs: t.Attr, line: line}
+
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, ValidationErrors{{Path: "/", Line: line, Message: "malformed xml: more than one root element"}}
+				}
+				root = n
+				n.path = "/" + n.name.Local
+			} else {
+				parent := stack[len(stack)-1]
+				index := 1
+				for _, c := range parent.children {
+					if c.name == n.name {
+						index++
+					}
+				}
+				n.path = fmt.Sprintf("%s/%s[%d]", parent.path, qualifiedName(n.name), index)
+				parent.children = append(parent.children, n)
+			}
+
+			stack = append(stack, n)
+			text.Reset()
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			if len(n.children) == 0 {
+				n.text = strings.TrimSpace(text.String())
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			text.Write(t)
+		}
+	}
+
+	if root == nil {
+		return nil, ValidationErrors{{Path: "/", Message: "malformed xml: no root element"}}
+	}
+
+	return root, nil
+}
+
+// rule describes an element that may appear inside its parent
+type rule struct {
+	space string
+	local string
+	min   int
+	// 0 means unbounded
+	max      int
+	check    func(n *node) string
+	children []rule
+}
+
+func (r rule) qualifiedName() string {
+	return qualifiedName(xml.Name{Space: r.space, Local: r.local})
+}
+
+// validateChildren checks the children of parent against rules
+func validateChildren(parent *node, rules []rule) ValidationErrors {
+	var errs ValidationErrors
+
+	for _, r := range rules {
+		var matches []*node
+		for _, c := range parent.find(r.local) {
+			if c.name.Space != r.space {
+				errs = append(errs, ValidationError{
+					Path:    c.path,
+					Line:    c.line,
+					Message: fmt.Sprintf("element %s must be in namespace %s, found '%s'", r.local, r.space, c.name.Space),
+				})
+				continue
+			}
+			matches = append(matches, c)
+		}
+
+		if len(matches) < r.min {
+			errs = append(errs, ValidationError{
+				Path:    parent.path + "/" + r.qualifiedName(),
+				Message: fmt.Sprintf("missing mandatory element %s", r.qualifiedName()),
+			})
+		}
+
+		if r.max > 0 && len(matches) > r.max {
+			errs = append(errs, ValidationError{
+				Path:    matches[r.max].path,
+				Line:    matches[r.max].line,
+				Message: fmt.Sprintf("element %s appears %d times, at most %d allowed", r.qualifiedName(), len(matches), r.max),
+			})
+		}
+
+		for _, m := range matches {
+			if r.check != nil {
+				if msg := r.check(m); msg != "" {
+					errs = append(errs, ValidationError{Path: m.path, Line: m.line, Message: msg})
+				}
+			}
+
+			errs = append(errs, validateChildren(m, r.children)...)
+		}
+	}
+
+	return errs
+}
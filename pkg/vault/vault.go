@@ -0,0 +1,155 @@
+// Package vault encrypts and decrypts files with a passphrase, using scrypt
+// to derive the key and AES-256-GCM to encrypt the content.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	formatVersion = 1
+	kdfScrypt     = "scrypt"
+	keyLength     = 32
+	saltLength    = 16
+)
+
+// scrypt parameters recommended for interactive logins
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted vault")
+var ErrEmptyPassphrase = errors.New("empty passphrase")
+
+// ErrInvalidParameters is returned when the KDF parameters of a vault are
+// not the ones written by Encrypt. They are checked before deriving the key,
+// a tampered file could otherwise make scrypt use gigabytes of memory.
+var ErrInvalidParameters = errors.New("invalid vault parameters")
+
+// file is the on disk representation of an encrypted vault
+type file struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Encrypt returns plaintext encrypted with a key derived from passphrase.
+// The result is a JSON document containing everything needed to decrypt it
+// except the passphrase.
+func Encrypt(plaintext []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	f := file{
+		Version: formatVersion,
+		KDF:     kdfScrypt,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, saltLength),
+	}
+
+	if _, err := rand.Read(f.Salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %w", err)
+	}
+
+	gcm, err := newGCM(passphrase, f)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, plaintext, additionalData(f))
+
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error serializing vault: %w", err)
+	}
+
+	return content, nil
+}
+
+// Decrypt returns the plaintext of a vault created with Encrypt
+func Decrypt(content []byte, passphrase string) ([]byte, error) {
+	var f file
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("error reading vault: %w", err)
+	}
+
+	if f.Version != formatVersion || f.KDF != kdfScrypt {
+		return nil, fmt.Errorf("unsupported vault version %d (%s)", f.Version, f.KDF)
+	}
+
+	if f.N != scryptN || f.R != scryptR || f.P != scryptP || len(f.Salt) != saltLength {
+		return nil, fmt.Errorf("%w: n=%d r=%d p=%d", ErrInvalidParameters, f.N, f.R, f.P)
+	}
+
+	gcm, err := newGCM(passphrase, f)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+
+	plaintext, err := gcm.Open(nil, f.Nonce, f.Ciphertext, additionalData(f))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+// IsVault reports whether content looks like an encrypted vault
+func IsVault(content []byte) bool {
+	var f file
+	if err := json.Unmarshal(content, &f); err != nil {
+		return false
+	}
+
+	return f.KDF != "" && len(f.Ciphertext) > 0
+}
+
+func newGCM(passphrase string, f file) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), f.Salt, f.N, f.R, f.P, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	return gcm, nil
+}
+
+// The KDF parameters are authenticated so they cannot be tampered with
+func additionalData(f file) []byte {
+	return []byte(fmt.Sprintf("v%d:%s:%d:%d:%d", f.Version, f.KDF, f.N, f.R, f.P))
+}
@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	plaintext := []byte("password: ClaveSOL\nclientSecret: secret\n")
+
+	content, err := Encrypt(plaintext, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(content, []byte("ClaveSOL")) {
+		t.Fatal("vault contains the plaintext")
+	}
+
+	if !IsVault(content) {
+		t.Fatal("expected content to be recognized as a vault")
+	}
+
+	decrypted, err := Decrypt(content, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("expected '%s', got '%s'", plaintext, decrypted)
+	}
+
+	if _, err := Decrypt(content, "wrong"); err != ErrWrongPassphrase {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestDecryptTamperedParameters(t *testing.T) {
+	content, err := Encrypt([]byte("password: ClaveSOL\n"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(f *file)
+	}{
+		{"huge n", func(f *file) { f.N = 1 << 30 }},
+		{"huge r", func(f *file) { f.R = 1 << 20 }},
+		{"huge p", func(f *file) { f.P = 1 << 20 }},
+		{"short salt", func(f *file) { f.Salt = f.Salt[:4] }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f file
+			if err := json.Unmarshal(content, &f); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.tamper(&f)
+
+			tampered, err := json.Marshal(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Decrypt(tampered, "passphrase"); !errors.Is(err, ErrInvalidParameters) {
+				t.Fatalf("expected ErrInvalidParameters, got %v", err)
+			}
+		})
+	}
+}